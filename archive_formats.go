@@ -0,0 +1,175 @@
+package libbuildpack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ArchiveFormat describes how InstallDependency recognises and unpacks a
+// downloaded dependency
+type ArchiveFormat struct {
+	// Name is matched against the format: field of a manifest entry
+	Name string
+	// Extensions are matched against the URI path when Detect does not recognise the contents
+	Extensions []string
+	// Detect reports whether header, the first bytes of the file, belongs to this format
+	Detect func(header []byte) bool
+	// Extract installs the downloaded file at outputPath
+	Extract func(file, outputPath string, opts ExtractOptions) error
+}
+
+const archiveHeaderSize = 512
+
+var archiveFormats []ArchiveFormat
+var archiveFormatsLock sync.Mutex
+
+func init() {
+	ResetArchiveFormats()
+}
+
+// AddArchiveFormat registers format, taking precedence over every format added before it
+func AddArchiveFormat(format ArchiveFormat) {
+	archiveFormatsLock.Lock()
+	archiveFormats = append([]ArchiveFormat{format}, archiveFormats...)
+	archiveFormatsLock.Unlock()
+}
+
+// ResetArchiveFormats removes every format added with AddArchiveFormat
+func ResetArchiveFormats() {
+	archiveFormatsLock.Lock()
+	archiveFormats = builtinArchiveFormats()
+	archiveFormatsLock.Unlock()
+}
+
+func builtinArchiveFormats() []ArchiveFormat {
+	return []ArchiveFormat{
+		{
+			Name:       "zip",
+			Extensions: []string{".zip"},
+			Detect:     hasMagic(0, []byte("PK\x03\x04"), []byte("PK\x05\x06")),
+			Extract:    extractIntoDir(extractZip),
+		},
+		{
+			Name:       "tar.gz",
+			Extensions: []string{".tar.gz", ".tgz"},
+			Detect:     hasMagic(0, []byte{0x1f, 0x8b}),
+			Extract:    extractIntoDir(extractTarGz),
+		},
+		{
+			Name:       "tar.xz",
+			Extensions: []string{".tar.xz", ".txz"},
+			Detect:     hasMagic(0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}),
+			Extract:    extractIntoDir(extractTarXz),
+		},
+		{
+			Name:       "tar.zst",
+			Extensions: []string{".tar.zst", ".tzst"},
+			Detect:     hasMagic(0, []byte{0x28, 0xb5, 0x2f, 0xfd}),
+			Extract:    extractIntoDir(extractTarZst),
+		},
+		{
+			Name:       "tar.bz2",
+			Extensions: []string{".tar.bz2", ".tbz2"},
+			Detect:     hasMagic(0, []byte("BZh")),
+			Extract:    extractIntoDir(extractTarBz2),
+		},
+		{
+			Name:       "tar",
+			Extensions: []string{".tar"},
+			Detect:     hasMagic(257, []byte("ustar")),
+			Extract:    extractIntoDir(extractTarFile),
+		},
+		{
+			Name:       "sh",
+			Extensions: []string{".sh"},
+			Detect:     hasMagic(0, []byte("#!")),
+			Extract:    renameFile,
+		},
+	}
+}
+
+func hasMagic(offset int, magics ...[]byte) func([]byte) bool {
+	return func(header []byte) bool {
+		for _, magic := range magics {
+			if len(header) >= offset+len(magic) && bytes.Equal(header[offset:offset+len(magic)], magic) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func extractIntoDir(extract func(string, string, ExtractOptions) error) func(string, string, ExtractOptions) error {
+	return func(file, outputDir string, opts ExtractOptions) error {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return err
+		}
+		return extract(file, outputDir, opts)
+	}
+}
+
+func renameFile(file, outputPath string, _ ExtractOptions) error {
+	return os.Rename(file, outputPath)
+}
+
+// detectArchiveFormat picks the format named by the entry, else the one
+// recognising the file contents, else the one matching the URI extension
+func detectArchiveFormat(entry *ManifestEntry, file string) (ArchiveFormat, error) {
+	archiveFormatsLock.Lock()
+	formats := append([]ArchiveFormat{}, archiveFormats...)
+	archiveFormatsLock.Unlock()
+
+	if entry.Format != "" {
+		for _, format := range formats {
+			if format.Name == entry.Format {
+				return format, nil
+			}
+		}
+		return ArchiveFormat{}, fmt.Errorf("unknown archive format %s for %s %s", entry.Format, entry.Dependency.Name, entry.Dependency.Version)
+	}
+
+	header, err := readHeader(file)
+	if err != nil {
+		return ArchiveFormat{}, err
+	}
+	for _, format := range formats {
+		if format.Detect != nil && format.Detect(header) {
+			return format, nil
+		}
+	}
+
+	uriPath := entry.URI
+	if u, err := url.Parse(entry.URI); err == nil {
+		uriPath = u.Path
+	}
+	for _, format := range formats {
+		for _, ext := range format.Extensions {
+			if strings.HasSuffix(path.Base(uriPath), ext) {
+				return format, nil
+			}
+		}
+	}
+
+	return ArchiveFormat{}, fmt.Errorf("could not determine the archive format of %s %s; set format: in the manifest", entry.Dependency.Name, entry.Dependency.Version)
+}
+
+func readHeader(file string) ([]byte, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	header := make([]byte, archiveHeaderSize)
+	n, err := io.ReadFull(fh, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return header[:n], nil
+}
@@ -0,0 +1,160 @@
+package libbuildpack_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ArchiveFormats", func() {
+	var (
+		oldCfStack  string
+		manifestDir string
+		outputDir   string
+		installer   *libbuildpack.Installer
+		entry       libbuildpack.ManifestEntry
+		contents    []byte
+		err         error
+	)
+
+	BeforeEach(func() {
+		oldCfStack = os.Getenv("CF_STACK")
+		os.Setenv("CF_STACK", "cflinuxfs2")
+		httpmock.Reset()
+
+		manifestDir, err = ioutil.TempDir("", "buildpack")
+		Expect(err).To(BeNil())
+		outputDir, err = ioutil.TempDir("", "output")
+		Expect(err).To(BeNil())
+
+		contents, err = ioutil.ReadFile("fixtures/thing.tgz")
+		Expect(err).To(BeNil())
+		entry = libbuildpack.ManifestEntry{
+			Dependency: libbuildpack.Dependency{Name: "thing", Version: "1"},
+			URI:        "https://example.com/download?artifact=thing&token=abc",
+			CFStacks:   []string{"cflinuxfs2"},
+		}
+	})
+
+	AfterEach(func() {
+		libbuildpack.ResetArchiveFormats()
+		Expect(os.Setenv("CF_STACK", oldCfStack)).To(Succeed())
+		Expect(os.RemoveAll(manifestDir)).To(Succeed())
+		Expect(os.RemoveAll(outputDir)).To(Succeed())
+	})
+
+	JustBeforeEach(func() {
+		sum := sha256.Sum256(contents)
+		entry.SHA256 = hex.EncodeToString(sum[:])
+		httpmock.RegisterResponder("GET", entry.URI, httpmock.NewBytesResponder(200, contents))
+
+		manifestForTest := libbuildpack.Manifest{LanguageString: "sample", ManifestEntries: []libbuildpack.ManifestEntry{entry}}
+		Expect(libbuildpack.NewYAML().Write(filepath.Join(manifestDir, "manifest.yml"), manifestForTest)).To(Succeed())
+
+		manifest, err := libbuildpack.NewManifest(manifestDir, libbuildpack.NewLogger(ansicleaner.New(&bytes.Buffer{})), time.Now())
+		Expect(err).To(BeNil())
+		installer = libbuildpack.NewInstaller(manifest)
+	})
+
+	Context("the uri has a query string and no extension", func() {
+		It("detects the format from the contents", func() {
+			Expect(installer.InstallDependency(entry.Dependency, outputDir)).To(Succeed())
+			Expect(ioutil.ReadFile(filepath.Join(outputDir, "thing", "bin", "file2.exe"))).To(Equal([]byte("progam2\n")))
+		})
+	})
+
+	Context("the contents are not recognised", func() {
+		BeforeEach(func() {
+			contents = []byte("plain text")
+		})
+
+		Context("the uri has a known extension", func() {
+			BeforeEach(func() {
+				entry.URI = "https://example.com/install.sh?token=abc"
+			})
+
+			It("falls back to the uri extension", func() {
+				outputFile := filepath.Join(outputDir, "install.sh")
+
+				Expect(installer.InstallDependency(entry.Dependency, outputFile)).To(Succeed())
+				Expect(ioutil.ReadFile(outputFile)).To(Equal(contents))
+			})
+		})
+
+		It("returns an error when nothing matches", func() {
+			err = installer.InstallDependency(entry.Dependency, outputDir)
+			Expect(err).To(MatchError(ContainSubstring("could not determine the archive format of thing 1")))
+		})
+	})
+
+	Context("the manifest entry declares a format", func() {
+		BeforeEach(func() {
+			contents, err = ioutil.ReadFile("fixtures/thing.zip")
+			Expect(err).To(BeNil())
+			entry.URI = "https://example.com/thing.tgz"
+			entry.Format = "zip"
+		})
+
+		It("uses that format", func() {
+			Expect(installer.InstallDependency(entry.Dependency, outputDir)).To(Succeed())
+			Expect(ioutil.ReadFile(filepath.Join(outputDir, "thing", "bin", "file2.exe"))).To(Equal([]byte("progam2\n")))
+		})
+	})
+
+	Context("the manifest entry declares an unknown format", func() {
+		BeforeEach(func() {
+			entry.Format = "rpm"
+		})
+
+		It("returns an error naming the format", func() {
+			err = installer.InstallDependency(entry.Dependency, outputDir)
+			Expect(err).To(MatchError(ContainSubstring("unknown archive format rpm")))
+		})
+	})
+
+	Context("extraction fails", func() {
+		BeforeEach(func() {
+			contents = []byte{0x1f, 0x8b, 'n', 'o', 't', ' ', 'g', 'z', 'i', 'p'}
+		})
+
+		It("says which format was attempted", func() {
+			err = installer.InstallDependency(entry.Dependency, outputDir)
+			Expect(err).To(MatchError(ContainSubstring("could not extract thing 1 as tar.gz")))
+		})
+	})
+
+	Context("a buildpack registers its own format", func() {
+		BeforeEach(func() {
+			contents = []byte("\x7fELF binary")
+			libbuildpack.AddArchiveFormat(libbuildpack.ArchiveFormat{
+				Name:   "binary",
+				Detect: func(header []byte) bool { return bytes.HasPrefix(header, []byte("\x7fELF")) },
+				Extract: func(file, outputDir string, _ libbuildpack.ExtractOptions) error {
+					if err := libbuildpack.CopyFile(file, filepath.Join(outputDir, "bin", "thing")); err != nil {
+						return err
+					}
+					return os.Chmod(filepath.Join(outputDir, "bin", "thing"), 0755)
+				},
+			})
+		})
+
+		It("uses the registered extractor", func() {
+			Expect(installer.InstallDependency(entry.Dependency, outputDir)).To(Succeed())
+
+			fi, err := os.Stat(filepath.Join(outputDir, "bin", "thing"))
+			Expect(err).To(BeNil())
+			Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0755)))
+		})
+	})
+})
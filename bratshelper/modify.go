@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 
+	"github.com/cloudfoundry/libbuildpack"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -21,19 +22,36 @@ func ModifyBuildpack(path string, cb func(path string, r io.Reader) (io.Reader,
 	}
 }
 
+// ModifyBuildpackManifest changes manifest.yml of the buildpack at path with cb.
+//
+// Deprecated: Manifest drops the keys it does not know about, use
+// ModifyManifest. ModifyBuildpackManifest will be removed in a future release.
 func ModifyBuildpackManifest(path string, cb func(*Manifest)) (string, error) {
 	return ModifyBuildpack(path, func(path string, r io.Reader) (io.Reader, error) {
 		if path == "manifest.yml" {
-			if r, err := changeManifest(r, cb); err != nil {
-				return nil, err
-			} else {
-				return r, nil
-			}
+			m := &Manifest{}
+			return changeYAML(r, m, func() { cb(m) })
+		}
+		return r, nil
+	})
+}
+
+// ModifyManifest changes manifest.yml of the buildpack at path with cb,
+// keeping the keys libbuildpack.Manifest does not know about, e.g. those of
+// compile-extensions
+func ModifyManifest(path string, cb func(*libbuildpack.Manifest)) (string, error) {
+	return ModifyBuildpack(path, func(path string, r io.Reader) (io.Reader, error) {
+		if path == "manifest.yml" {
+			m := &libbuildpack.Manifest{}
+			return changeYAML(r, m, func() { cb(m) })
 		}
 		return r, nil
 	})
 }
 
+// Manifest is manifest.yml as ModifyBuildpackManifest reads it.
+//
+// Deprecated: use ModifyManifest and libbuildpack.Manifest.
 type Manifest struct {
 	Stack           string `yaml:"stack"`
 	Language        string `yaml:"language"`
@@ -116,20 +134,20 @@ func modifyZipfile(path string, cb func(path string, r io.Reader) (io.Reader, er
 	return newfile.Name(), nil
 }
 
-func changeManifest(r io.Reader, cb func(*Manifest)) (io.Reader, error) {
+// changeYAML reads r into obj, calls cb and writes obj back out
+func changeYAML(r io.Reader, obj interface{}, cb func()) (io.Reader, error) {
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
 
-	obj := Manifest{}
-	if err := yaml.Unmarshal(data, &obj); err != nil {
+	if err := yaml.Unmarshal(data, obj); err != nil {
 		return nil, err
 	}
 
-	cb(&obj)
+	cb()
 
-	if data, err := yaml.Marshal(&obj); err != nil {
+	if data, err := yaml.Marshal(obj); err != nil {
 		return nil, err
 	} else {
 		return bytes.NewReader(data), nil
@@ -118,10 +118,10 @@ func StagingWithBuildpackThatSetsEOL(depName string, copyBrats func(string) *cut
 		)
 		JustBeforeEach(func() {
 			eolDate = time.Now().AddDate(0, 0, 10).Format("2006-01-02")
-			file, err := ModifyBuildpackManifest(buildpackFile, func(m *Manifest) {
-				for _, eol := range m.DependencyDeprecationDates {
-					if eol.Name == depName {
-						eol.Date = eolDate
+			file, err := ModifyManifest(buildpackFile, func(m *libbuildpack.Manifest) {
+				for idx := range m.Deprecations {
+					if m.Deprecations[idx].Name == depName {
+						m.Deprecations[idx].Date = eolDate
 					}
 				}
 			})
@@ -200,8 +200,9 @@ func StagingWithCustomBuildpackWithCredentialsInDependencies(copyBrats func(stri
 			app                                              *cutlass.App
 		)
 		JustBeforeEach(func() {
-			file, err := ModifyBuildpackManifest(buildpackFile, func(m *Manifest) {
-				for _, d := range m.Dependencies {
+			file, err := ModifyManifest(buildpackFile, func(m *libbuildpack.Manifest) {
+				for idx := range m.ManifestEntries {
+					d := &m.ManifestEntries[idx]
 					uri, err := url.Parse(d.URI)
 					if proxyHost, ok := os.LookupEnv("PROXY_HOST"); ok {
 						uri.Host = proxyHost
@@ -0,0 +1,259 @@
+package libbuildpack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// AppCachePolicy decides which dependencies CleanupAppCache keeps in the app cache
+type AppCachePolicy struct {
+	// MaxBytes is the size cached dependencies may take up; dependencies not
+	// used in this staging are evicted least recently used first to stay below
+	// it. Zero keeps every dependency.
+	MaxBytes int64
+	// KeepVersions is the number of versions of each dependency kept, counting
+	// the ones used in this staging. Zero keeps every version.
+	KeepVersions int
+}
+
+func DefaultAppCachePolicy() AppCachePolicy {
+	return AppCachePolicy{MaxBytes: 1 << 30, KeepVersions: 3}
+}
+
+// CachedDependency is one entry of the app cache
+type CachedDependency struct {
+	Dependency Dependency
+	Path       string
+	Size       int64
+	LastUsed   time.Time
+	// Used is true for dependencies fetched in this staging
+	Used bool
+	// Reason explains why an evicted dependency was removed
+	Reason string
+}
+
+// AppCacheReport describes what CleanupAppCache kept and evicted
+type AppCacheReport struct {
+	Kept           []CachedDependency
+	Evicted        []CachedDependency
+	KeptBytes      int64
+	ReclaimedBytes int64
+}
+
+const (
+	cachedArtifact = "artifact"
+	cachedMetadata = "metadata.yml"
+)
+
+// cachedDependency is stored next to every artifact in the app cache
+type cachedDependency struct {
+	Dependency Dependency `yaml:",inline"`
+	URI        string     `yaml:"uri"`
+}
+
+// cacheKey addresses an entry by its digest, so identical bytes share one
+// cache entry whatever their URI
+func cacheKey(entry *ManifestEntry) string {
+	if entry.SHA256 == "" && entry.SHA512 != "" {
+		return filepath.Join("sha512", entry.SHA512)
+	}
+	return filepath.Join("sha256", entry.SHA256)
+}
+
+func isCacheKeyDir(name string) bool {
+	return name == "sha256" || name == "sha512"
+}
+
+// findCachedDependency looks for key in this buildpack's app cache, then in
+// the app caches of the other buildpacks of this staging, which live next to it
+func (i *Installer) findCachedDependency(key string) (string, error) {
+	own := filepath.Join(i.appCacheDir, key, cachedArtifact)
+	if exists, err := FileExists(own); err != nil || exists {
+		return own, err
+	}
+
+	others, err := filepath.Glob(filepath.Join(filepath.Dir(filepath.Dir(i.appCacheDir)), "*", filepath.Base(i.appCacheDir), key, cachedArtifact))
+	if err != nil {
+		return "", err
+	}
+	for _, other := range others {
+		if fi, err := os.Stat(other); err == nil && fi.Mode().IsRegular() {
+			return other, nil
+		}
+	}
+	return "", nil
+}
+
+func (i *Installer) fetchAppCachedBuildpackDependency(entry *ManifestEntry, outputFile string) error {
+	key := cacheKey(entry)
+	cacheDir := filepath.Join(i.appCacheDir, key)
+
+	i.mu.Lock()
+	i.filesInAppCache[cacheDir] = true
+	i.mu.Unlock()
+
+	cacheFile, err := i.findCachedDependency(key)
+	if err != nil {
+		return err
+	}
+
+	if cacheFile != "" {
+		i.manifest.log.Info("Copy [%s]", cacheFile)
+		if err := copyAndVerify(entry, cacheFile, outputFile, i.manifest.log); err != nil {
+			return err
+		}
+	} else {
+		client, err := i.client()
+		if err != nil {
+			return err
+		}
+		if err := i.manifest.downloadDependency(client, entry, outputFile, i.downloadOptions); err != nil {
+			return err
+		}
+	}
+
+	return i.storeCachedDependency(entry, outputFile, cacheDir)
+}
+
+func (i *Installer) storeCachedDependency(entry *ManifestEntry, file, cacheDir string) error {
+	cacheFile := filepath.Join(cacheDir, cachedArtifact)
+	if exists, err := FileExists(cacheFile); err != nil {
+		return err
+	} else if !exists {
+		if err := CopyFile(file, cacheFile); err != nil {
+			return err
+		}
+		if err := NewYAML().Write(filepath.Join(cacheDir, cachedMetadata), cachedDependency{Dependency: entry.Dependency, URI: entry.URI}); err != nil {
+			return err
+		}
+	}
+
+	// the modification time of the directory records when it was last used
+	now := time.Now()
+	return os.Chtimes(cacheDir, now, now)
+}
+
+// appCacheEntries lists the content addressed entries of the app cache, and
+// every other path directly below it
+func (i *Installer) appCacheEntries() ([]CachedDependency, []string, error) {
+	var entries []CachedDependency
+	var others []string
+
+	top, err := ioutil.ReadDir(i.appCacheDir)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	for _, fi := range top {
+		path := filepath.Join(i.appCacheDir, fi.Name())
+		if !fi.IsDir() || !isCacheKeyDir(fi.Name()) {
+			others = append(others, path)
+			continue
+		}
+
+		digests, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, digest := range digests {
+			entry := CachedDependency{Path: filepath.Join(path, digest.Name()), LastUsed: digest.ModTime()}
+			_, entry.Used = i.filesInAppCache[entry.Path]
+			entry.Size, err = dirSize(entry.Path)
+			if err != nil {
+				return nil, nil, err
+			}
+			var metadata cachedDependency
+			if err := NewYAML().Load(filepath.Join(entry.Path, cachedMetadata), &metadata); err == nil {
+				entry.Dependency = metadata.Dependency
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, others, nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// CleanupAppCache keeps the dependencies used in this staging, and as many of
+// the most recently used others as the AppCachePolicy allows
+func (i *Installer) CleanupAppCache() error {
+	_, err := i.PruneAppCache()
+	return err
+}
+
+// PruneAppCache is CleanupAppCache, returning a report of what it did
+func (i *Installer) PruneAppCache() (AppCacheReport, error) {
+	var report AppCacheReport
+
+	entries, others, err := i.appCacheEntries()
+	if err != nil {
+		return report, fmt.Errorf("Failed while cleaning up app cache; couldn't look at %s because: %v", i.appCacheDir, err)
+	}
+
+	sort.SliceStable(entries, func(a, b int) bool {
+		if entries[a].Used != entries[b].Used {
+			return entries[a].Used
+		}
+		return entries[a].LastUsed.After(entries[b].LastUsed)
+	})
+
+	for _, path := range others {
+		size, _ := dirSize(path)
+		report.Evicted = append(report.Evicted, CachedDependency{Path: path, Size: size, Reason: "left over from an older app cache layout"})
+	}
+
+	policy := i.appCachePolicy
+	versions := map[string]int{}
+	for _, entry := range entries {
+		name := entry.Dependency.Name
+		switch {
+		case entry.Used:
+		case policy.KeepVersions > 0 && name != "" && versions[name] >= policy.KeepVersions:
+			entry.Reason = fmt.Sprintf("more than %d versions of %s are cached", policy.KeepVersions, name)
+		case policy.MaxBytes > 0 && report.KeptBytes+entry.Size > policy.MaxBytes:
+			entry.Reason = fmt.Sprintf("the app cache is limited to %d bytes", policy.MaxBytes)
+		}
+
+		if entry.Reason != "" {
+			report.Evicted = append(report.Evicted, entry)
+			continue
+		}
+		versions[name]++
+		report.Kept = append(report.Kept, entry)
+		report.KeptBytes += entry.Size
+	}
+
+	for _, entry := range report.Evicted {
+		i.manifest.log.Debug("Deleting cached file: %s (%s)", entry.Path, entry.Reason)
+		if err := os.RemoveAll(entry.Path); err != nil {
+			return report, fmt.Errorf("Failed while cleaning up app cache; couldn't delete %s because: %v", entry.Path, err)
+		}
+		report.ReclaimedBytes += entry.Size
+	}
+
+	if len(report.Kept) > 0 || len(report.Evicted) > 0 {
+		i.manifest.log.Info("App cache: kept %d dependencies (%d bytes), evicted %d (%d bytes reclaimed)",
+			len(report.Kept), report.KeptBytes, len(report.Evicted), report.ReclaimedBytes)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,86 @@
+package libbuildpack
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// entryDigest hashes the bytes of a dependency as they are written, so the
+// artifact never has to be read back into memory to be verified
+type entryDigest struct {
+	entry  *ManifestEntry
+	sha256 hash.Hash
+	sha512 hash.Hash
+}
+
+func newEntryDigest(entry *ManifestEntry) *entryDigest {
+	d := &entryDigest{entry: entry}
+	if entry.SHA256 != "" || entry.SHA512 == "" {
+		d.sha256 = sha256.New()
+	}
+	if entry.SHA512 != "" {
+		d.sha512 = sha512.New()
+	}
+	return d
+}
+
+func (d *entryDigest) Write(p []byte) (int, error) {
+	if d.sha256 != nil {
+		d.sha256.Write(p)
+	}
+	if d.sha512 != nil {
+		d.sha512.Write(p)
+	}
+	return len(p), nil
+}
+
+func (d *entryDigest) Reset() {
+	if d.sha256 != nil {
+		d.sha256.Reset()
+	}
+	if d.sha512 != nil {
+		d.sha512.Reset()
+	}
+}
+
+func (d *entryDigest) verify() error {
+	if d.sha256 != nil {
+		if actual := hex.EncodeToString(d.sha256.Sum(nil)); actual != d.entry.SHA256 {
+			return fmt.Errorf("dependency sha256 mismatch: expected sha256 %s, actual sha256 %s", d.entry.SHA256, actual)
+		}
+	}
+	if d.sha512 != nil {
+		if actual := hex.EncodeToString(d.sha512.Sum(nil)); actual != d.entry.SHA512 {
+			return fmt.Errorf("dependency sha512 mismatch: expected sha512 %s, actual sha512 %s", d.entry.SHA512, actual)
+		}
+	}
+	return nil
+}
+
+// copyAndVerify copies source to outputFile, hashing it on the way through
+func copyAndVerify(entry *ManifestEntry, source, outputFile string, log *Logger) error {
+	fh, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	fileInfo, err := fh.Stat()
+	if err != nil {
+		return err
+	}
+
+	digest := newEntryDigest(entry)
+	progress := log.Progress("Copying", fileInfo.Size())
+	if err := writeToFile(io.TeeReader(fh, io.MultiWriter(digest, progress)), outputFile, fileInfo.Mode()); err != nil {
+		return err
+	}
+	progress.Done()
+
+	return deleteBadFile(digest, outputFile)
+}
@@ -0,0 +1,287 @@
+package libbuildpack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DownloadOptions controls how dependencies are fetched over HTTP
+type DownloadOptions struct {
+	// Retries is the number of further attempts made after a failed download
+	Retries int
+	// RetryBackoff is the wait before the first retry; it doubles on every retry after that
+	RetryBackoff time.Duration
+	// Timeout bounds a whole download including retries; zero means no limit
+	Timeout time.Duration
+	// ReadTimeout aborts an attempt when no data arrives for this long; zero means no limit
+	ReadTimeout time.Duration
+	// Concurrency is the number of dependencies PrefetchDependencies fetches at once
+	Concurrency int
+}
+
+func DefaultDownloadOptions() DownloadOptions {
+	return DownloadOptions{
+		Retries:      3,
+		RetryBackoff: time.Second,
+		ReadTimeout:  time.Minute,
+		Concurrency:  4,
+	}
+}
+
+type downloadStatusError int
+
+func (e downloadStatusError) Error() string {
+	return fmt.Sprintf("could not download: %d", int(e))
+}
+
+func (e downloadStatusError) retryable() bool {
+	return int(e) >= 500 || int(e) == http.StatusTooManyRequests || int(e) == http.StatusRequestTimeout
+}
+
+// hashWriter is fed every byte written to the destination file, and is reset
+// whenever a download has to start over
+type hashWriter interface {
+	io.Writer
+	Reset()
+}
+
+type resumableDownload struct {
+	client    *http.Client
+	url       string
+	file      *os.File
+	digest    hashWriter
+	progress  *Progress
+	written   int64
+	validator string
+}
+
+func downloadFile(client *http.Client, url, destFile string, opts DownloadOptions, digest hashWriter, progress *Progress) error {
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destFile), 0755); err != nil {
+		return err
+	}
+
+	fh, err := os.OpenFile(destFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	d := &resumableDownload{client: client, url: url, file: fh, digest: digest, progress: progress}
+	backoff := opts.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		err = d.attempt(ctx, opts.ReadTimeout)
+		if err == nil || attempt >= opts.Retries || !retryableDownloadError(err) || ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+		backoff *= 2
+	}
+
+	if ctx.Err() != nil && err != nil {
+		err = fmt.Errorf("could not download: %v", ctx.Err())
+	}
+
+	if err == nil {
+		progress.Done()
+	}
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(destFile)
+	}
+	return err
+}
+
+// networkError is an error receiving a download, as opposed to a local error
+// such as a full disk
+type networkError struct {
+	err error
+}
+
+func (e networkError) Error() string { return e.err.Error() }
+func (e networkError) Unwrap() error { return e.err }
+
+// networkReader marks the errors reading a response body as network errors
+type networkReader struct {
+	r io.Reader
+}
+
+func (n networkReader) Read(p []byte) (int, error) {
+	count, err := n.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = networkError{err}
+	}
+	return count, err
+}
+
+// retryableDownloadError retries network errors, timeouts and server errors
+func retryableDownloadError(err error) bool {
+	switch e := err.(type) {
+	case downloadStatusError:
+		return e.retryable()
+	case networkError:
+		return true
+	case *url.Error:
+		if _, ok := e.Err.(net.Error); ok {
+			return true
+		}
+		return e.Err == io.EOF || e.Err == io.ErrUnexpectedEOF || e.Err == context.Canceled
+	default:
+		return false
+	}
+}
+
+func (d *resumableDownload) attempt(ctx context.Context, readTimeout time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequest("GET", d.url, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	if d.written > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", d.written))
+		if d.validator != "" {
+			req.Header.Set("If-Range", d.validator)
+		}
+	}
+
+	var timer *timeoutReader
+	if readTimeout > 0 {
+		timer = newTimeoutReader(readTimeout, cancel)
+		defer timer.stop()
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return timer.wrapErr(err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && d.written > 0 && contentRangeStart(resp) == d.written:
+		// the server honoured the Range header, keep appending to what we have
+	case resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		offset := d.written
+		d.validator = ""
+		if err := d.restart(); err != nil {
+			return err
+		}
+		return networkError{fmt.Errorf("could not resume download at byte %d", offset)}
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		if err := d.restart(); err != nil {
+			return err
+		}
+		d.validator = resp.Header.Get("ETag")
+		if d.validator == "" {
+			d.validator = resp.Header.Get("Last-Modified")
+		}
+	default:
+		return downloadStatusError(resp.StatusCode)
+	}
+
+	if resp.ContentLength >= 0 {
+		d.progress.SetTotal(d.written + resp.ContentLength)
+	}
+
+	var body io.Reader = networkReader{resp.Body}
+	if timer != nil {
+		timer.r = body
+		body = timer
+	}
+
+	dest := io.MultiWriter(d.file, d.progress)
+	if d.digest != nil {
+		dest = io.MultiWriter(d.file, d.digest, d.progress)
+	}
+
+	n, err := io.Copy(dest, body)
+	d.written += n
+	return timer.wrapErr(err)
+}
+
+func (d *resumableDownload) restart() error {
+	d.written = 0
+	d.progress.Reset()
+	if d.digest != nil {
+		d.digest.Reset()
+	}
+	if err := d.file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := d.file.Seek(0, io.SeekStart)
+	return err
+}
+
+func contentRangeStart(resp *http.Response) int64 {
+	contentRange := strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	idx := strings.Index(contentRange, "-")
+	if idx < 0 {
+		return -1
+	}
+	start, err := strconv.ParseInt(contentRange[:idx], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// timeoutReader cancels a request when neither headers nor body bytes arrive within timeout
+type timeoutReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+	expired int32
+}
+
+func newTimeoutReader(timeout time.Duration, cancel context.CancelFunc) *timeoutReader {
+	t := &timeoutReader{timeout: timeout}
+	t.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&t.expired, 1)
+		cancel()
+	})
+	return t
+}
+
+func (t *timeoutReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if atomic.LoadInt32(&t.expired) == 0 {
+		t.timer.Reset(t.timeout)
+	}
+	return n, err
+}
+
+func (t *timeoutReader) stop() {
+	t.timer.Stop()
+}
+
+func (t *timeoutReader) wrapErr(err error) error {
+	if err != nil && t != nil && atomic.LoadInt32(&t.expired) == 1 {
+		return networkError{fmt.Errorf("no data received for %s: %v", t.timeout, err)}
+	}
+	return err
+}
@@ -6,23 +6,34 @@ const defaultVersionsError = "The buildpack manifest is misconfigured for 'defau
 	"Contact your Cloud Foundry operator/admin. For more information, see " +
 	"https://docs.cloudfoundry.org/buildpacks/custom.html#specifying-default-versions"
 
-func dependencyMissingError(m *Manifest, dep Dependency) string {
+func dependencyMissingError(m *StackManifest, dep Dependency) string {
 	var msg string
-	otherVersions := m.AllDependencyVersions(dep.Name)
+	resolution, _ := m.Resolve(dep.Name, dep.Version)
 
 	msg += fmt.Sprintf("DEPENDENCY MISSING IN MANIFEST:\n\n")
 
-	if otherVersions == nil {
+	if len(resolution.Considered) == 0 && len(resolution.Filtered) == 0 {
 		msg += fmt.Sprintf("Dependency %s is not provided by this buildpack\n", dep.Name)
+		return msg
+	}
+
+	msg += fmt.Sprintf("Version %s of dependency %s is not supported by this buildpack.\n", dep.Version, dep.Name)
+	if len(resolution.Considered) == 0 {
+		msg += fmt.Sprintf("Dependency %s is not provided for stack %s.\n", dep.Name, m.Stack())
 	} else {
-		msg += fmt.Sprintf("Version %s of dependency %s is not supported by this buildpack.\n", dep.Version, dep.Name)
-		msg += fmt.Sprintf("The versions of %s supported in this buildpack are:\n", dep.Name)
+		msg += fmt.Sprintf("The versions of %s supported in this buildpack nearest to %s are:\n", dep.Name, dep.Version)
 
-		for _, ver := range otherVersions {
+		for _, ver := range resolution.Nearest(5) {
 			msg += fmt.Sprintf("\t- %s\n", ver)
 		}
 	}
 
+	for _, e := range resolution.Filtered {
+		if e.Version == dep.Version {
+			msg += fmt.Sprintf("Version %s is only provided for %s.\n", dep.Version, entryPlatform(e))
+		}
+	}
+
 	return msg
 }
 
@@ -43,3 +54,15 @@ func endOfLifeWarning(depName, versionLine, eolDate, link string) string {
 
 	return fmt.Sprintf(warning, depName, versionLine, eolDate)
 }
+
+func endOfLifeError(dep Dependency, deprecation DeprecationDate, optInEnv string) string {
+	msg := fmt.Sprintf("%s %s is no longer supported by this buildpack, its version line %s reached its end of life on %s.",
+		dep.Name, dep.Version, deprecation.VersionLine, deprecation.Date)
+	if optInEnv != "" {
+		msg += fmt.Sprintf("\nSet %s=true to install it anyway.", optInEnv)
+	}
+	if deprecation.Link != "" {
+		msg += fmt.Sprintf("\nSee: %s", deprecation.Link)
+	}
+	return msg
+}
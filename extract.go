@@ -0,0 +1,321 @@
+package libbuildpack
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExtractLimits bounds what a single archive may expand to on disk
+type ExtractLimits struct {
+	// MaxBytes caps the total uncompressed size of all entries
+	MaxBytes int64
+	// MaxEntries caps the number of entries of any type
+	MaxEntries int
+}
+
+// DefaultExtractLimits is used by ExtractZip, ExtractTar and friends
+var DefaultExtractLimits = ExtractLimits{
+	MaxBytes:   16 << 30,
+	MaxEntries: 500000,
+}
+
+// ExtractOptions select which part of an archive is extracted
+type ExtractOptions struct {
+	// StripComponents drops this many leading path elements from every entry,
+	// like tar --strip-components; entries with fewer elements are skipped
+	StripComponents int
+	// Include, when set, only extracts entries below this path (after
+	// stripping), placing its contents directly in the destination
+	Include string
+	// Progress, when set, is written every extracted byte
+	Progress io.Writer
+	// Log, when set, warns about the entries that are skipped
+	Log *Logger
+}
+
+const maxSymlinkTargetSize = 4096
+
+// archiveExtractor writes the entries of an archive below destDir. Every
+// entry type is resolved against the real (symlink free) destination, so
+// nothing can be written, linked or hard linked outside of it. Ownership is
+// never preserved; extracted files belong to the staging user.
+type archiveExtractor struct {
+	destDir  string
+	limits   ExtractLimits
+	opts     ExtractOptions
+	written  int64
+	entries  int
+	dirTimes []dirTime
+}
+
+type dirTime struct {
+	path    string
+	modTime time.Time
+}
+
+func newArchiveExtractor(destDir string, opts ExtractOptions) (*archiveExtractor, error) {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return nil, err
+	}
+
+	realDest, err := filepath.Abs(destDir)
+	if err != nil {
+		return nil, err
+	}
+	realDest, err = filepath.EvalSymlinks(realDest)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Include = filepath.Clean(filepath.FromSlash(strings.Trim(opts.Include, `/\`)))
+	if opts.Include == "." {
+		opts.Include = ""
+	}
+
+	return &archiveExtractor{destDir: realDest, limits: DefaultExtractLimits, opts: opts}, nil
+}
+
+// skip warns that the entry name is not extracted, and why
+func (x *archiveExtractor) skip(name, reason string) {
+	if x.opts.Log != nil {
+		x.opts.Log.Warning("Skipping %s: %s", name, reason)
+	}
+}
+
+func (x *archiveExtractor) within(path string) bool {
+	return path == x.destDir || strings.HasPrefix(path, x.destDir+string(os.PathSeparator))
+}
+
+// relative maps an entry name to a path below the destination, applying
+// StripComponents and Include; ok is false when the entry is not extracted
+func (x *archiveExtractor) relative(name string) (rel string, ok bool, err error) {
+	rel = filepath.Clean(filepath.FromSlash(strings.TrimLeft(name, `/\`)))
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) || filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" {
+		return "", false, fmt.Errorf("cannot extract %s outside of the destination directory", name)
+	}
+
+	if x.opts.StripComponents > 0 {
+		parts := strings.Split(rel, string(os.PathSeparator))
+		if rel == "." || len(parts) <= x.opts.StripComponents {
+			return "", false, nil
+		}
+		rel = filepath.Join(parts[x.opts.StripComponents:]...)
+	}
+
+	if x.opts.Include != "" {
+		if rel == x.opts.Include {
+			return ".", true, nil
+		}
+		if !strings.HasPrefix(rel, x.opts.Include+string(os.PathSeparator)) {
+			return "", false, nil
+		}
+		rel = strings.TrimPrefix(rel, x.opts.Include+string(os.PathSeparator))
+	}
+
+	return rel, true, nil
+}
+
+// resolve maps an entry name onto the disk, creating its parent directories;
+// it returns an empty path for entries that are not extracted
+func (x *archiveExtractor) resolve(name string) (string, error) {
+	x.entries++
+	if x.limits.MaxEntries > 0 && x.entries > x.limits.MaxEntries {
+		return "", fmt.Errorf("archive has more than %d entries", x.limits.MaxEntries)
+	}
+
+	rel, ok, err := x.relative(name)
+	if err != nil || !ok {
+		return "", err
+	}
+	if rel == "." {
+		return x.destDir, nil
+	}
+
+	// a directory created by an earlier symlink entry may point elsewhere, so
+	// check where the parent really is before creating any of it
+	realParent, err := x.evalPath(x.destDir, filepath.Dir(rel))
+	if err != nil {
+		return "", fmt.Errorf("cannot extract %s: %v", name, err)
+	}
+	if !x.within(realParent) {
+		return "", fmt.Errorf("cannot extract %s outside of the destination directory", name)
+	}
+	if err := os.MkdirAll(realParent, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(realParent, filepath.Base(rel))
+	if fi, err := os.Lstat(path); err == nil && !fi.IsDir() {
+		if err := os.Remove(path); err != nil {
+			return "", err
+		}
+	}
+
+	return path, nil
+}
+
+// evalPath joins rel to the real directory base one element at a time,
+// following the symlinks on disk, so that ".." is applied to where a link
+// really points instead of to its name. Elements that do not exist yet are
+// joined as they are, but may not be followed by "..", as a link extracted
+// later could change what they mean.
+func (x *archiveExtractor) evalPath(base, rel string) (string, error) {
+	path, missing := base, ""
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		switch {
+		case part == "" || part == ".":
+		case part == "..":
+			if missing != "" {
+				return "", fmt.Errorf("%s does not exist", missing)
+			}
+			path = filepath.Dir(path)
+		case missing != "":
+			path = filepath.Join(path, part)
+		default:
+			path = filepath.Join(path, part)
+			fi, err := os.Lstat(path)
+			if os.IsNotExist(err) {
+				missing = path
+				continue
+			} else if err != nil {
+				return "", err
+			}
+			if fi.Mode()&os.ModeSymlink != 0 {
+				if path, err = filepath.EvalSymlinks(path); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	return path, nil
+}
+
+func (x *archiveExtractor) dir(name string, mode os.FileMode, modTime time.Time) error {
+	path, err := x.resolve(name)
+	if err != nil || path == "" {
+		return err
+	}
+
+	if mode.Perm() == 0 {
+		mode = 0755
+	}
+	if err := os.MkdirAll(path, mode.Perm()); err != nil {
+		return err
+	}
+
+	x.dirTimes = append(x.dirTimes, dirTime{path, modTime})
+	return nil
+}
+
+func (x *archiveExtractor) file(name string, mode os.FileMode, modTime time.Time, src io.Reader) error {
+	path, err := x.resolve(name)
+	if err != nil || path == "" {
+		return err
+	}
+
+	if x.limits.MaxBytes > 0 {
+		src = io.LimitReader(src, x.limits.MaxBytes-x.written+1)
+	}
+	if x.opts.Progress != nil {
+		src = io.TeeReader(src, x.opts.Progress)
+	}
+	counter := &countingReader{r: src}
+	if err := writeToFile(counter, path, mode.Perm()); err != nil {
+		return err
+	}
+
+	x.written += counter.n
+	if x.limits.MaxBytes > 0 && x.written > x.limits.MaxBytes {
+		os.Remove(path)
+		return fmt.Errorf("archive expands to more than %d bytes", x.limits.MaxBytes)
+	}
+
+	return setModTime(path, modTime)
+}
+
+func (x *archiveExtractor) symlink(name, linkname string) error {
+	if filepath.IsAbs(linkname) {
+		return fmt.Errorf("cannot link to an absolute path when extracting archives")
+	}
+
+	path, err := x.resolve(name)
+	if err != nil || path == "" {
+		return err
+	}
+
+	// check that the relative link does not escape the destination dir, also
+	// through the links extracted before it
+	target, err := x.evalPath(filepath.Dir(path), linkname)
+	if err != nil {
+		return fmt.Errorf("cannot link %s to %s: %v", name, linkname, err)
+	}
+	if !x.within(target) {
+		return fmt.Errorf("cannot link outside of the destination directory when extracting archives")
+	}
+
+	return os.Symlink(linkname, path)
+}
+
+func (x *archiveExtractor) hardlink(name, linkname string) error {
+	path, err := x.resolve(name)
+	if err != nil || path == "" {
+		return err
+	}
+
+	rel, ok, err := x.relative(linkname)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("cannot hard link %s to %s: the target is not extracted", name, linkname)
+	}
+	target, err := filepath.EvalSymlinks(filepath.Join(x.destDir, rel))
+	if err != nil {
+		return fmt.Errorf("cannot hard link %s to %s: %v", name, linkname, err)
+	}
+	if !x.within(target) {
+		return fmt.Errorf("cannot link outside of the destination directory when extracting archives")
+	}
+
+	fi, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("cannot hard link %s to %s: not a regular file", name, linkname)
+	}
+
+	return os.Link(target, path)
+}
+
+// finish sets directory mtimes last, as extracting into a directory changes it
+func (x *archiveExtractor) finish() error {
+	for i := len(x.dirTimes) - 1; i >= 0; i-- {
+		if err := setModTime(x.dirTimes[i].path, x.dirTimes[i].modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setModTime(path string, modTime time.Time) error {
+	if modTime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(path, modTime, modTime)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
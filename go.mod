@@ -1,5 +1,7 @@
 module github.com/cloudfoundry/libbuildpack
 
+go 1.20
+
 require (
 	github.com/BurntSushi/toml v0.3.1
 	github.com/Masterminds/semver v1.4.2
@@ -7,15 +9,23 @@ require (
 	github.com/elazarl/goproxy v0.0.0-20181111060418-2ce16c963a8a
 	github.com/golang/mock v1.2.0
 	github.com/google/subcommands v0.0.0-20181012225330-46f0354f6315
-	github.com/kr/pretty v0.1.0 // indirect
+	github.com/klauspost/compress v1.15.15
 	github.com/onsi/ginkgo v1.7.0
 	github.com/onsi/gomega v1.4.3
 	github.com/tidwall/gjson v1.1.3
+	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/net v0.0.0-20181220203305-927f97764cc3
+	gopkg.in/jarcoal/httpmock.v1 v1.0.0-20181117152235-275e9df93516
+	gopkg.in/yaml.v2 v2.2.2
+)
+
+require (
+	github.com/hpcloud/tail v1.0.0 // indirect
+	github.com/kr/pretty v0.1.0 // indirect
 	github.com/tidwall/match v1.0.1 // indirect
-	golang.org/x/net v0.0.0-20181220203305-927f97764cc3 // indirect
-	golang.org/x/sync v0.0.0-20181221193216-37e7f081c4d4 // indirect
 	golang.org/x/sys v0.0.0-20181221143128-b4a75ba826a6 // indirect
+	golang.org/x/text v0.3.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
-	gopkg.in/jarcoal/httpmock.v1 v1.0.0-20181117152235-275e9df93516
-	gopkg.in/yaml.v2 v2.2.2
+	gopkg.in/fsnotify.v1 v1.4.7 // indirect
+	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
 )
@@ -0,0 +1,259 @@
+package libbuildpack
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// HTTPOptions configures the client that downloads dependencies
+type HTTPOptions struct {
+	// CAFiles are PEM bundles trusted in addition to the system roots
+	CAFiles []string
+	// CACerts are PEM certificates trusted in addition to the system roots
+	CACerts []string
+	// ClientCertFile and ClientKeyFile hold a PEM certificate and key for servers that ask for one
+	ClientCertFile string
+	ClientKeyFile  string
+	// ClientCert and ClientKey are PEM contents used instead of ClientCertFile and ClientKeyFile
+	ClientCert string
+	ClientKey  string
+	// Headers are added to requests for matching hosts
+	Headers []HTTPHeader
+	// Proxy, when set, is used for http and https requests instead of HTTP_PROXY and HTTPS_PROXY
+	Proxy string
+	// NoProxy, when set, lists the hosts that bypass Proxy in the format of NO_PROXY
+	NoProxy string
+}
+
+// HTTPHeader is sent with every request to Host, or to every host when Host is "*"
+type HTTPHeader struct {
+	Host  string
+	Name  string
+	Value string
+}
+
+const (
+	DependencyCAFilesEnv    = "BP_DEPENDENCY_CA_FILES"
+	DependencyClientCertEnv = "BP_DEPENDENCY_CLIENT_CERT"
+	DependencyClientKeyEnv  = "BP_DEPENDENCY_CLIENT_KEY"
+	DependencyHeadersEnv    = "BP_DEPENDENCY_HEADERS"
+)
+
+// dependencyDownloadTag marks the VCAP_SERVICES bindings read by HTTPOptionsFromEnv
+const dependencyDownloadTag = "dependency-download"
+
+// HTTPOptionsFromEnv reads HTTPOptions from the BP_DEPENDENCY_* variables and
+// from service bindings tagged dependency-download, whose credentials may hold
+// host, headers, ca_cert, client_cert and client_key. The headers of a binding
+// are only sent to its host, which it must name. Proxies come from
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY as usual.
+func HTTPOptionsFromEnv() (HTTPOptions, error) {
+	var opts HTTPOptions
+
+	if caFiles := os.Getenv(DependencyCAFilesEnv); caFiles != "" {
+		opts.CAFiles = filepath.SplitList(caFiles)
+	}
+	opts.ClientCertFile = os.Getenv(DependencyClientCertEnv)
+	opts.ClientKeyFile = os.Getenv(DependencyClientKeyEnv)
+
+	for _, line := range strings.Split(os.Getenv(DependencyHeadersEnv), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		header, err := parseHTTPHeader(line)
+		if err != nil {
+			return HTTPOptions{}, err
+		}
+		opts.Headers = append(opts.Headers, header)
+	}
+
+	if err := opts.addServiceBindings(os.Getenv("VCAP_SERVICES")); err != nil {
+		return HTTPOptions{}, err
+	}
+
+	return opts, nil
+}
+
+func parseHTTPHeader(line string) (HTTPHeader, error) {
+	hostAndName := strings.SplitN(line, " ", 2)
+	if len(hostAndName) == 2 {
+		nameAndValue := strings.SplitN(hostAndName[1], ":", 2)
+		if len(nameAndValue) == 2 && strings.TrimSpace(nameAndValue[0]) != "" {
+			return HTTPHeader{
+				Host:  hostAndName[0],
+				Name:  strings.TrimSpace(nameAndValue[0]),
+				Value: strings.TrimSpace(nameAndValue[1]),
+			}, nil
+		}
+	}
+	return HTTPHeader{}, fmt.Errorf("invalid %s entry %q, expected host Name: value", DependencyHeadersEnv, line)
+}
+
+func (opts *HTTPOptions) addServiceBindings(vcapServices string) error {
+	if vcapServices == "" {
+		return nil
+	}
+
+	var services map[string][]struct {
+		Name        string   `json:"name"`
+		Tags        []string `json:"tags"`
+		Credentials struct {
+			Host       string            `json:"host"`
+			Headers    map[string]string `json:"headers"`
+			CACert     string            `json:"ca_cert"`
+			ClientCert string            `json:"client_cert"`
+			ClientKey  string            `json:"client_key"`
+		} `json:"credentials"`
+	}
+	if err := json.Unmarshal([]byte(vcapServices), &services); err != nil {
+		return fmt.Errorf("could not parse VCAP_SERVICES: %v", err)
+	}
+
+	for _, instances := range services {
+		for _, instance := range instances {
+			if !containsString(instance.Tags, dependencyDownloadTag) {
+				continue
+			}
+			creds := instance.Credentials
+			if len(creds.Headers) > 0 && creds.Host == "" {
+				return fmt.Errorf("service %s has headers but no host to send them to", instance.Name)
+			}
+			for name, value := range creds.Headers {
+				opts.Headers = append(opts.Headers, HTTPHeader{Host: creds.Host, Name: name, Value: value})
+			}
+			if creds.CACert != "" {
+				opts.CACerts = append(opts.CACerts, creds.CACert)
+			}
+			if creds.ClientCert != "" || creds.ClientKey != "" {
+				if creds.ClientCert == "" || creds.ClientKey == "" {
+					return fmt.Errorf("service %s needs both client_cert and client_key", instance.Name)
+				}
+				opts.ClientCert, opts.ClientKey = creds.ClientCert, creds.ClientKey
+			}
+		}
+	}
+	return nil
+}
+
+// NewHTTPClient builds a client for opts. Without TLS or proxy settings it
+// shares http.DefaultTransport.
+func NewHTTPClient(opts HTTPOptions) (*http.Client, error) {
+	var transport http.RoundTripper = http.DefaultTransport
+
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig != nil || opts.Proxy != "" || opts.NoProxy != "" {
+		t, ok := http.DefaultTransport.(*http.Transport)
+		if ok {
+			t = t.Clone()
+		} else {
+			t = &http.Transport{Proxy: http.ProxyFromEnvironment}
+		}
+		if tlsConfig != nil {
+			t.TLSClientConfig = tlsConfig
+		}
+		if opts.Proxy != "" || opts.NoProxy != "" {
+			config := httpproxy.FromEnvironment()
+			if opts.Proxy != "" {
+				config.HTTPProxy, config.HTTPSProxy = opts.Proxy, opts.Proxy
+			}
+			if opts.NoProxy != "" {
+				config.NoProxy = opts.NoProxy
+			}
+			proxyFunc := config.ProxyFunc()
+			t.Proxy = func(req *http.Request) (*url.URL, error) { return proxyFunc(req.URL) }
+		}
+		transport = t
+	}
+
+	if len(opts.Headers) > 0 {
+		transport = &headerTransport{base: transport, headers: opts.Headers}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+func (opts HTTPOptions) tlsConfig() (*tls.Config, error) {
+	if len(opts.CAFiles) == 0 && len(opts.CACerts) == 0 && opts.ClientCertFile == "" && opts.ClientCert == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+
+	if len(opts.CAFiles) > 0 || len(opts.CACerts) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		for _, file := range opts.CAFiles {
+			pem, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("could not read CA file: %v", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in CA file %s", file)
+			}
+		}
+		for _, pem := range opts.CACerts {
+			if !pool.AppendCertsFromPEM([]byte(pem)) {
+				return nil, fmt.Errorf("no certificates found in CA certificate")
+			}
+		}
+		config.RootCAs = pool
+	}
+
+	var cert tls.Certificate
+	var err error
+	switch {
+	case opts.ClientCert != "":
+		cert, err = tls.X509KeyPair([]byte(opts.ClientCert), []byte(opts.ClientKey))
+	case opts.ClientCertFile != "":
+		cert, err = tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not load client certificate: %v", err)
+	}
+	if len(cert.Certificate) > 0 {
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+type headerTransport struct {
+	base    http.RoundTripper
+	headers []HTTPHeader
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for _, header := range t.headers {
+		if header.Host == "*" || strings.EqualFold(header.Host, req.URL.Hostname()) || strings.EqualFold(header.Host, req.URL.Host) {
+			req.Header.Set(header.Name, header.Value)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+package libbuildpack_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTP client", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "http_client")
+		Expect(err).To(BeNil())
+		httpmock.Reset()
+	})
+	AfterEach(func() { Expect(os.RemoveAll(tmpDir)).To(Succeed()) })
+
+	get := func(client *http.Client, url string) (string, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	Describe("HTTPOptionsFromEnv", func() {
+		var oldEnv map[string]string
+
+		BeforeEach(func() {
+			oldEnv = map[string]string{}
+			for _, name := range []string{libbuildpack.DependencyCAFilesEnv, libbuildpack.DependencyClientCertEnv, libbuildpack.DependencyClientKeyEnv, libbuildpack.DependencyHeadersEnv, "VCAP_SERVICES"} {
+				oldEnv[name] = os.Getenv(name)
+				os.Unsetenv(name)
+			}
+		})
+		AfterEach(func() {
+			for name, value := range oldEnv {
+				os.Setenv(name, value)
+			}
+		})
+
+		It("reads files and headers from the environment", func() {
+			os.Setenv(libbuildpack.DependencyCAFilesEnv, "/a.pem"+string(os.PathListSeparator)+"/b.pem")
+			os.Setenv(libbuildpack.DependencyClientCertEnv, "/cert.pem")
+			os.Setenv(libbuildpack.DependencyClientKeyEnv, "/key.pem")
+			os.Setenv(libbuildpack.DependencyHeadersEnv, "artifacts.internal Authorization: Bearer abc\n* X-Foundation: offline")
+
+			opts, err := libbuildpack.HTTPOptionsFromEnv()
+			Expect(err).To(BeNil())
+			Expect(opts.CAFiles).To(Equal([]string{"/a.pem", "/b.pem"}))
+			Expect(opts.ClientCertFile).To(Equal("/cert.pem"))
+			Expect(opts.ClientKeyFile).To(Equal("/key.pem"))
+			Expect(opts.Headers).To(Equal([]libbuildpack.HTTPHeader{
+				{Host: "artifacts.internal", Name: "Authorization", Value: "Bearer abc"},
+				{Host: "*", Name: "X-Foundation", Value: "offline"},
+			}))
+		})
+
+		It("rejects malformed headers", func() {
+			os.Setenv(libbuildpack.DependencyHeadersEnv, "Authorization")
+			_, err := libbuildpack.HTTPOptionsFromEnv()
+			Expect(err).To(MatchError(ContainSubstring("expected host Name: value")))
+		})
+
+		It("reads service bindings tagged dependency-download", func() {
+			os.Setenv("VCAP_SERVICES", `{"user-provided": [
+				{"name": "artifacts", "tags": ["dependency-download"], "credentials": {"host": "artifacts.internal", "headers": {"Authorization": "Bearer abc"}, "ca_cert": "PEM"}},
+				{"name": "database", "tags": ["mysql"], "credentials": {"headers": {"Authorization": "ignored"}}}
+			]}`)
+
+			opts, err := libbuildpack.HTTPOptionsFromEnv()
+			Expect(err).To(BeNil())
+			Expect(opts.Headers).To(Equal([]libbuildpack.HTTPHeader{{Host: "artifacts.internal", Name: "Authorization", Value: "Bearer abc"}}))
+			Expect(opts.CACerts).To(Equal([]string{"PEM"}))
+		})
+
+		It("does not send the headers of a binding without a host to every host", func() {
+			os.Setenv("VCAP_SERVICES", `{"user-provided": [
+				{"name": "artifacts", "tags": ["dependency-download"], "credentials": {"headers": {"Authorization": "Bearer abc"}}}
+			]}`)
+
+			_, err := libbuildpack.HTTPOptionsFromEnv()
+			Expect(err).To(MatchError("service artifacts has headers but no host to send them to"))
+		})
+	})
+
+	Describe("NewHTTPClient", func() {
+		It("adds headers to requests for matching hosts", func() {
+			var received http.Header
+			httpmock.RegisterResponder("GET", "https://artifacts.internal/dep.tgz", func(req *http.Request) (*http.Response, error) {
+				received = req.Header
+				return httpmock.NewStringResponse(200, "data"), nil
+			})
+			httpmock.RegisterResponder("GET", "https://example.com/dep.tgz", func(req *http.Request) (*http.Response, error) {
+				received = req.Header
+				return httpmock.NewStringResponse(200, "data"), nil
+			})
+
+			client, err := libbuildpack.NewHTTPClient(libbuildpack.HTTPOptions{Headers: []libbuildpack.HTTPHeader{
+				{Host: "artifacts.internal", Name: "Authorization", Value: "Bearer abc"},
+				{Host: "*", Name: "X-Foundation", Value: "offline"},
+			}})
+			Expect(err).To(BeNil())
+
+			Expect(get(client, "https://artifacts.internal/dep.tgz")).To(Equal("data"))
+			Expect(received.Get("Authorization")).To(Equal("Bearer abc"))
+			Expect(received.Get("X-Foundation")).To(Equal("offline"))
+
+			Expect(get(client, "https://example.com/dep.tgz")).To(Equal("data"))
+			Expect(received.Get("Authorization")).To(BeEmpty())
+			Expect(received.Get("X-Foundation")).To(Equal("offline"))
+		})
+
+		Context("with a server using a private CA", func() {
+			var server *httptest.Server
+
+			BeforeEach(func() {
+				server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if len(r.TLS.PeerCertificates) > 0 {
+						fmt.Fprintf(w, "hello %s", r.TLS.PeerCertificates[0].Subject.CommonName)
+						return
+					}
+					fmt.Fprint(w, "hello")
+				}))
+				server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+				server.StartTLS()
+
+				caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+				Expect(ioutil.WriteFile(filepath.Join(tmpDir, "ca.pem"), caPEM, 0644)).To(Succeed())
+			})
+			AfterEach(func() { server.Close() })
+
+			It("trusts the CA files", func() {
+				client, err := libbuildpack.NewHTTPClient(libbuildpack.HTTPOptions{CAFiles: []string{filepath.Join(tmpDir, "ca.pem")}})
+				Expect(err).To(BeNil())
+				Expect(get(client, server.URL)).To(Equal("hello"))
+			})
+
+			It("rejects the server without them", func() {
+				client, err := libbuildpack.NewHTTPClient(libbuildpack.HTTPOptions{CACerts: []string{string(testCertificate("other").cert)}})
+				Expect(err).To(BeNil())
+				_, err = get(client, server.URL)
+				Expect(err).To(MatchError(ContainSubstring("certificate")))
+			})
+
+			It("presents the client certificate", func() {
+				clientCert := testCertificate("buildpack")
+				Expect(ioutil.WriteFile(filepath.Join(tmpDir, "cert.pem"), clientCert.cert, 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(tmpDir, "key.pem"), clientCert.key, 0600)).To(Succeed())
+
+				client, err := libbuildpack.NewHTTPClient(libbuildpack.HTTPOptions{
+					CAFiles:        []string{filepath.Join(tmpDir, "ca.pem")},
+					ClientCertFile: filepath.Join(tmpDir, "cert.pem"),
+					ClientKeyFile:  filepath.Join(tmpDir, "key.pem"),
+				})
+				Expect(err).To(BeNil())
+				Expect(get(client, server.URL)).To(Equal("hello buildpack"))
+			})
+
+			It("reports unreadable CA files", func() {
+				_, err := libbuildpack.NewHTTPClient(libbuildpack.HTTPOptions{CAFiles: []string{filepath.Join(tmpDir, "missing.pem")}})
+				Expect(err).To(MatchError(ContainSubstring("could not read CA file")))
+			})
+		})
+
+		Context("with a proxy", func() {
+			var (
+				proxy   *httptest.Server
+				proxied []string
+			)
+
+			BeforeEach(func() {
+				proxied = nil
+				proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					proxied = append(proxied, r.URL.String())
+					fmt.Fprint(w, "proxied")
+				}))
+			})
+			AfterEach(func() { proxy.Close() })
+
+			It("sends requests through it", func() {
+				client, err := libbuildpack.NewHTTPClient(libbuildpack.HTTPOptions{Proxy: proxy.URL})
+				Expect(err).To(BeNil())
+				Expect(get(client, "http://deps.invalid/dep.tgz")).To(Equal("proxied"))
+				Expect(proxied).To(Equal([]string{"http://deps.invalid/dep.tgz"}))
+			})
+
+			It("skips it for hosts in NoProxy", func() {
+				client, err := libbuildpack.NewHTTPClient(libbuildpack.HTTPOptions{Proxy: proxy.URL, NoProxy: "other.invalid,deps.invalid"})
+				Expect(err).To(BeNil())
+				_, err = get(client, "http://deps.invalid/dep.tgz")
+				Expect(err).ToNot(BeNil())
+				Expect(proxied).To(BeEmpty())
+			})
+		})
+	})
+})
+
+type pemPair struct {
+	cert, key []byte
+}
+
+func testCertificate(commonName string) pemPair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(BeNil())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).To(BeNil())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).To(BeNil())
+
+	return pemPair{
+		cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
@@ -1,26 +1,50 @@
 package libbuildpack
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"github.com/Masterminds/semver"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
-	"time"
+	"sync"
 )
 
 type Installer struct {
 	manifest        *Manifest
+	stack           *StackManifest
 	appCacheDir     string
 	filesInAppCache map[string]interface{}
 	versionLine     *map[string]string
+	downloadOptions DownloadOptions
+	appCachePolicy  AppCachePolicy
+	httpClient      *http.Client
+	prefetched      map[Dependency]string
+	installed       []ManifestEntry
+	mu              sync.Mutex
 }
 
 func NewInstaller(manifest *Manifest) *Installer {
-	return &Installer{manifest, "", make(map[string]interface{}), &map[string]string{}}
+	return &Installer{
+		manifest:        manifest,
+		filesInAppCache: make(map[string]interface{}),
+		versionLine:     &map[string]string{},
+		downloadOptions: DefaultDownloadOptions(),
+		appCachePolicy:  DefaultAppCachePolicy(),
+		prefetched:      make(map[Dependency]string),
+	}
+}
+
+// SetStack makes the installer resolve dependencies for stack instead of CF_STACK
+func (i *Installer) SetStack(stack string) {
+	i.stack = i.manifest.ForStack(stack)
+}
+
+func (i *Installer) stackManifest() *StackManifest {
+	if i.stack != nil {
+		return i.stack
+	}
+	return i.manifest.currentStack()
 }
 
 func (i *Installer) SetAppCacheDir(appCacheDir string) (err error) {
@@ -28,7 +52,49 @@ func (i *Installer) SetAppCacheDir(appCacheDir string) (err error) {
 	return
 }
 
+func (i *Installer) SetAppCachePolicy(policy AppCachePolicy) {
+	i.appCachePolicy = policy
+}
+
+func (i *Installer) SetDownloadOptions(opts DownloadOptions) {
+	i.downloadOptions = opts
+}
+
+// SetHTTPOptions replaces the options otherwise read by HTTPOptionsFromEnv
+func (i *Installer) SetHTTPOptions(opts HTTPOptions) error {
+	client, err := NewHTTPClient(opts)
+	if err != nil {
+		return err
+	}
+	i.mu.Lock()
+	i.httpClient = client
+	i.mu.Unlock()
+	return nil
+}
+
+func (i *Installer) client() (*http.Client, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.httpClient == nil {
+		opts, err := HTTPOptionsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		if i.httpClient, err = NewHTTPClient(opts); err != nil {
+			return nil, err
+		}
+	}
+	return i.httpClient, nil
+}
+
 func (i *Installer) InstallDependency(dep Dependency, outputDir string) error {
+	return i.InstallDependencyWithOptions(dep, outputDir, ExtractOptions{})
+}
+
+// InstallDependencyWithOptions is InstallDependency with extraction options
+// that take precedence over strip_components and include in the manifest
+func (i *Installer) InstallDependencyWithOptions(dep Dependency, outputDir string, opts ExtractOptions) error {
 	i.manifest.log.BeginStep("Installing %s %s", dep.Name, dep.Version)
 
 	tmpDir, err := ioutil.TempDir("", "downloads")
@@ -39,12 +105,18 @@ func (i *Installer) InstallDependency(dep Dependency, outputDir string) error {
 
 	tmpFile := filepath.Join(tmpDir, "archive")
 
-	entry, err := i.manifest.GetEntry(dep)
+	entry, err := i.stackManifest().GetEntry(dep)
+	if err != nil {
+		return err
+	}
+
+	// a version line past its end of life may not be installed at all
+	err = i.warnEndOfLife(dep)
 	if err != nil {
 		return err
 	}
 
-	err = i.FetchDependency(dep, tmpFile)
+	err = i.fetch(dep, tmpFile)
 	if err != nil {
 		return err
 	}
@@ -54,33 +126,57 @@ func (i *Installer) InstallDependency(dep Dependency, outputDir string) error {
 		return err
 	}
 
-	err = i.warnEndOfLife(dep)
+	format, err := detectArchiveFormat(entry, tmpFile)
 	if err != nil {
 		return err
 	}
 
-	if strings.HasSuffix(entry.URI, ".sh") {
-		return os.Rename(tmpFile, outputDir)
+	if opts.StripComponents == 0 {
+		opts.StripComponents = entry.StripComponents
+	}
+	if opts.Include == "" {
+		opts.Include = entry.Include
+	}
+	if opts.Log == nil {
+		opts.Log = i.manifest.log
 	}
 
-	err = os.MkdirAll(outputDir, 0755)
-	if err != nil {
-		return err
+	if progress := i.manifest.log.Progress("Extracting", 0); opts.Progress == nil && progress != nil {
+		defer progress.Done()
+		opts.Progress = progress
 	}
 
-	if strings.HasSuffix(entry.URI, ".zip") {
-		return ExtractZip(tmpFile, outputDir)
+	if err := format.Extract(tmpFile, outputDir, opts); err != nil {
+		return fmt.Errorf("could not extract %s %s as %s: %v", dep.Name, dep.Version, format.Name, err)
 	}
 
-	if strings.HasSuffix(entry.URI, ".tar.xz") {
-		return ExtractTarXz(tmpFile, outputDir)
+	i.recordInstalled(*entry)
+	return nil
+}
+
+func (i *Installer) recordInstalled(entry ManifestEntry) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, installed := range i.installed {
+		if installed.Dependency == entry.Dependency {
+			return
+		}
 	}
+	i.installed = append(i.installed, entry)
+}
 
-	return ExtractTarGz(tmpFile, outputDir)
+// InstalledDependencies lists the manifest entries of every dependency
+// installed or fetched so far, in the order they were installed
+func (i *Installer) InstalledDependencies() []ManifestEntry {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return append([]ManifestEntry{}, i.installed...)
 }
 
 func (i *Installer) warnNewerPatch(dep Dependency) error {
-	versions := i.manifest.AllDependencyVersions(dep.Name)
+	versions := i.stackManifest().AllDependencyVersions(dep.Name)
 
 	v, err := semver.NewVersion(dep.Version)
 	if err != nil {
@@ -100,55 +196,53 @@ func (i *Installer) warnNewerPatch(dep Dependency) error {
 	}
 
 	if latest != dep.Version {
-		i.manifest.log.Warning(outdatedDependencyWarning(dep, latest))
+		i.manifest.log.Warning("%s", outdatedDependencyWarning(dep, latest))
 	}
 
 	return nil
 }
 
 func (i *Installer) warnEndOfLife(dep Dependency) error {
-	matchVersion := func(versionLine, depVersion string) bool {
-		return versionLine == depVersion
-	}
-
-	v, err := semver.NewVersion(dep.Version)
-	if err == nil {
-		matchVersion = func(versionLine, depVersion string) bool {
-			constraint, err := semver.NewConstraint(versionLine)
-			if err != nil {
-				return false
-			}
+	return i.manifest.CheckDeprecation(dep)
+}
 
-			return constraint.Check(v)
-		}
+// FetchDependency downloads dep to outputFile without extracting it, and
+// records it in InstalledDependencies
+func (i *Installer) FetchDependency(dep Dependency, outputFile string) error {
+	if err := i.fetch(dep, outputFile); err != nil {
+		return err
 	}
 
-	for _, deprecation := range i.manifest.Deprecations {
-		if deprecation.Name != dep.Name {
-			continue
-		}
-		if !matchVersion(deprecation.VersionLine, dep.Version) {
-			continue
-		}
-
-		eolTime, err := time.Parse(dateFormat, deprecation.Date)
-		if err != nil {
-			return err
-		}
-
-		if eolTime.Sub(i.manifest.currentTime) < thirtyDays {
-			i.manifest.log.Warning(endOfLifeWarning(dep.Name, deprecation.VersionLine, deprecation.Date, deprecation.Link))
-		}
+	entry, err := i.stackManifest().GetEntry(dep)
+	if err != nil {
+		return err
 	}
+	i.recordInstalled(*entry)
 	return nil
 }
 
-func (i *Installer) FetchDependency(dep Dependency, outputFile string) error {
-	entry, err := i.manifest.GetEntry(dep)
+func (i *Installer) fetch(dep Dependency, outputFile string) error {
+	entry, err := i.stackManifest().GetEntry(dep)
 	if err != nil {
 		return err
 	}
 
+	i.mu.Lock()
+	prefetchedFile, found := i.prefetched[dep]
+	i.mu.Unlock()
+
+	if found { // this file was downloaded by PrefetchDependencies
+		i.manifest.log.Info("Copy [%s]", prefetchedFile)
+		return copyAndVerify(entry, prefetchedFile, outputFile, i.manifest.log)
+	}
+
+	if err := i.fetchDependency(entry, outputFile); err != nil {
+		return err
+	}
+	return i.verifySignature(entry, outputFile)
+}
+
+func (i *Installer) fetchDependency(entry *ManifestEntry, outputFile string) error {
 	if entry.File != "" { // this file is cached by the buildpack
 		return fetchCachedBuildpackDependency(entry, outputFile, i.manifest.manifestRootDir, i.manifest.log)
 	}
@@ -157,42 +251,74 @@ func (i *Installer) FetchDependency(dep Dependency, outputFile string) error {
 		return i.fetchAppCachedBuildpackDependency(entry, outputFile)
 	}
 
-	return downloadDependency(entry, outputFile, i.manifest.log)
+	client, err := i.client()
+	if err != nil {
+		return err
+	}
+	return i.manifest.downloadDependency(client, entry, outputFile, i.downloadOptions)
 }
 
-func (i *Installer) CleanupAppCache() error {
-	pathsToDelete := []string{}
+// PrefetchDependencies fetches deps into dir, DownloadOptions.Concurrency at a
+// time, so that later calls to InstallDependency only need a local copy.
+func (i *Installer) PrefetchDependencies(deps []Dependency, dir string) error {
+	concurrency := i.downloadOptions.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-	if err := filepath.Walk(i.appCacheDir, func(path string, info os.FileInfo, err error) error {
-		if info == nil || info.IsDir() {
-			return nil
-		}
-		if err != nil {
-			return fmt.Errorf("Failed while cleaning up app cache; couldn't look at %s because: %v", path, err)
-		}
-		if path == i.appCacheDir {
-			return nil
+	var unique []Dependency
+	seen := map[Dependency]bool{}
+	for _, dep := range deps {
+		if !seen[dep] {
+			seen[dep] = true
+			unique = append(unique, dep)
 		}
-		if _, ok := i.filesInAppCache[path]; !ok {
-			pathsToDelete = append(pathsToDelete, path)
-		}
-		return nil
-	}); err != nil {
-		return err
 	}
 
-	for _, path := range pathsToDelete {
-		i.manifest.log.Debug("Deleting cached file: %s", path)
-		if err := os.RemoveAll(path); err != nil {
-			return fmt.Errorf("Failed while cleaning up app cache; couldn't delete %s because: %v", path, err)
-		}
+	sem := make(chan struct{}, concurrency)
+	errs := make([]error, len(unique))
+	var wg sync.WaitGroup
+
+	for idx, dep := range unique {
+		wg.Add(1)
+		go func(idx int, dep Dependency) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			outputFile := filepath.Join(dir, fmt.Sprintf("%d", idx), "archive")
+			if err := i.fetch(dep, outputFile); err != nil {
+				errs[idx] = fmt.Errorf("could not prefetch %s %s: %v", dep.Name, dep.Version, err)
+				return
+			}
+
+			i.mu.Lock()
+			i.prefetched[dep] = outputFile
+			i.mu.Unlock()
+		}(idx, dep)
 	}
+	wg.Wait()
 
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// InstallRequestedVersion installs the version of depName chosen by
+// StackManifest.RequestedVersion from sources
+func (i *Installer) InstallRequestedVersion(depName string, installDir string, sources ...VersionSource) (VersionRequest, error) {
+	request, err := i.stackManifest().RequestedVersion(depName, sources...)
+	if err != nil {
+		return VersionRequest{}, err
+	}
+	return request, i.InstallDependency(request.Dependency, installDir)
+}
+
 func (i *Installer) InstallOnlyVersion(depName string, installDir string) error {
-	depVersions := i.manifest.AllDependencyVersions(depName)
+	depVersions := i.stackManifest().AllDependencyVersions(depName)
 
 	if len(depVersions) > 1 {
 		return fmt.Errorf("more than one version of %s found", depName)
@@ -204,36 +330,6 @@ func (i *Installer) InstallOnlyVersion(depName string, installDir string) error
 	return i.InstallDependency(dep, installDir)
 }
 
-func (i *Installer) fetchAppCachedBuildpackDependency(entry *ManifestEntry, outputFile string) error {
-	shaURI := sha256.Sum256([]byte(entry.URI))
-	cacheFile := filepath.Join(i.appCacheDir, hex.EncodeToString(shaURI[:]), filepath.Base(entry.URI))
-
-	i.filesInAppCache[cacheFile] = true
-	i.filesInAppCache[filepath.Dir(cacheFile)] = true
-
-	foundCacheFile, err := FileExists(cacheFile)
-	if err != nil {
-		return err
-	}
-
-	if foundCacheFile {
-		i.manifest.log.Info("Copy [%s]", cacheFile)
-		if err := CopyFile(cacheFile, outputFile); err != nil {
-			return err
-		}
-		return deleteBadFile(entry, outputFile)
-	}
-
-	if err := downloadDependency(entry, outputFile, i.manifest.log); err != nil {
-		return err
-	}
-	if err := CopyFile(outputFile, cacheFile); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func (i *Installer) SetVersionLine(depName string, line string) {
 	(*i.versionLine)[depName] = line
 }
@@ -5,10 +5,16 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Logger struct {
-	w io.Writer
+	w            io.Writer
+	mu           sync.Mutex
+	showProgress *bool
+	steps        []StepTiming
+	stepStart    time.Time
 }
 
 const (
@@ -45,6 +51,7 @@ func (l *Logger) Debug(format string, args ...interface{}) {
 }
 
 func (l *Logger) BeginStep(format string, args ...interface{}) {
+	l.startStep(fmt.Sprintf(format, args...))
 	l.printWithHeader("----->", format, args...)
 }
 
@@ -57,6 +64,9 @@ func (l *Logger) printWithHeader(header string, format string, args ...interface
 	msg := fmt.Sprintf(format, args...)
 
 	msg = strings.Replace(msg, "\n", "\n       ", -1)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	fmt.Fprintf(l.w, "%s %s\n", header, msg)
 }
 
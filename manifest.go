@@ -3,10 +3,13 @@ package libbuildpack
 import (
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	yaml "gopkg.in/yaml.v2"
 )
 
 const dateFormat = "2006-01-02"
@@ -21,26 +24,53 @@ type DeprecationDate struct {
 	Name        string `yaml:"name"`
 	VersionLine string `yaml:"version_line"`
 	Date        string `yaml:"date"`
-	Link        string `yaml:"link"`
+	Link        string `yaml:"link,omitempty"`
+	raw         yaml.MapSlice
 }
 
 type ManifestEntry struct {
-	Dependency Dependency `yaml:",inline"`
-	URI        string     `yaml:"uri"`
-	File       string     `yaml:"file"`
-	SHA256     string     `yaml:"sha256"`
-	CFStacks   []string   `yaml:"cf_stacks"`
-}
-
+	Dependency      `yaml:",inline"`
+	URI             string   `yaml:"uri,omitempty"`
+	File            string   `yaml:"file,omitempty"`
+	SHA256          string   `yaml:"sha256,omitempty"`
+	SHA512          string   `yaml:"sha512,omitempty"`
+	CFStacks        []string `yaml:"cf_stacks,omitempty"`
+	Arch            string   `yaml:"arch,omitempty"`
+	OS              string   `yaml:"os,omitempty"`
+	Modules         []string `yaml:"modules,omitempty"`
+	Licenses        []string `yaml:"licenses,omitempty"`
+	CPE             string   `yaml:"cpe,omitempty"`
+	PURL            string   `yaml:"purl,omitempty"`
+	Source          string   `yaml:"source,omitempty"`
+	SourceSHA256    string   `yaml:"source_sha256,omitempty"`
+	Format          string   `yaml:"format,omitempty"`
+	StripComponents int      `yaml:"strip_components,omitempty"`
+	Include         string   `yaml:"include,omitempty"`
+	SignatureURI    string   `yaml:"signature_uri,omitempty"`
+	SignatureFile   string   `yaml:"signature_file,omitempty"`
+	PublicKey       string   `yaml:"public_key,omitempty"`
+	raw             yaml.MapSlice
+}
+
+// Manifest is a buildpack's manifest.yml, as used for staging and packaging.
+// Reading and writing it keeps keys it does not know about.
 type Manifest struct {
-	LanguageString  string            `yaml:"language"`
-	DefaultVersions []Dependency      `yaml:"default_versions"`
-	ManifestEntries []ManifestEntry   `yaml:"dependencies"`
-	Deprecations    []DeprecationDate `yaml:"dependency_deprecation_dates"`
-	Stack           string            `yaml:"stack"`
-	manifestRootDir string
-	currentTime     time.Time //move into installer?
-	log             *Logger
+	LanguageString    string              `yaml:"language"`
+	DefaultVersions   []Dependency        `yaml:"default_versions,omitempty"`
+	ManifestEntries   []ManifestEntry     `yaml:"dependencies,omitempty"`
+	Deprecations      []DeprecationDate   `yaml:"dependency_deprecation_dates,omitempty"`
+	Stack             string              `yaml:"stack,omitempty"`
+	IncludeFiles      []string            `yaml:"include_files,omitempty"`
+	PrePackage        string              `yaml:"pre_package,omitempty"`
+	Includes          []string            `yaml:"includes,omitempty"`
+	DependencyMirrors []DependencyMirror  `yaml:"dependency_mirrors,omitempty"`
+	StackAliases      map[string][]string `yaml:"stack_aliases,omitempty"`
+	DeprecationPolicy DeprecationPolicy   `yaml:"deprecation_policy,omitempty"`
+	manifestRootDir   string
+	overrideChanges   []OverrideChange
+	currentTime       time.Time //move into installer?
+	log               *Logger
+	raw               yaml.MapSlice
 }
 
 type BuildpackMetadata struct {
@@ -49,10 +79,7 @@ type BuildpackMetadata struct {
 }
 
 func NewManifest(bpDir string, logger *Logger, currentTime time.Time) (*Manifest, error) {
-	var m Manifest
-	y := &YAML{}
-
-	err := y.Load(filepath.Join(bpDir, "manifest.yml"), &m)
+	m, err := ReadManifest(bpDir)
 	if err != nil {
 		return nil, err
 	}
@@ -65,60 +92,7 @@ func NewManifest(bpDir string, logger *Logger, currentTime time.Time) (*Manifest
 	m.currentTime = currentTime
 	m.log = logger
 
-	return &m, nil
-}
-
-func (m *Manifest) replaceDefaultVersion(oDep Dependency) {
-	replaced := false
-	for idx, mDep := range m.DefaultVersions {
-		if mDep.Name == oDep.Name {
-			replaced = true
-			m.DefaultVersions[idx] = oDep
-		}
-	}
-	if !replaced {
-		m.DefaultVersions = append(m.DefaultVersions, oDep)
-	}
-}
-func (m *Manifest) replaceManifestEntry(oEntry ManifestEntry) {
-	oDep := oEntry.Dependency
-	replaced := false
-	for idx, mEntry := range m.ManifestEntries {
-		mDep := mEntry.Dependency
-		if mDep.Name == oDep.Name && mDep.Version == oDep.Version {
-			replaced = true
-			m.ManifestEntries[idx] = mEntry
-		}
-	}
-	if !replaced {
-		m.ManifestEntries = append(m.ManifestEntries, oEntry)
-	}
-}
-
-func (m *Manifest) ApplyOverride(depsDir string) error {
-	files, err := filepath.Glob(filepath.Join(depsDir, "*", "override.yml"))
-	if err != nil {
-		return err
-	}
-
-	for _, file := range files {
-		var overrideYml map[string]Manifest
-		y := &YAML{}
-		if err := y.Load(file, &overrideYml); err != nil {
-			return err
-		}
-
-		if o, found := overrideYml[m.Language()]; found {
-			for _, oDep := range o.DefaultVersions {
-				m.replaceDefaultVersion(oDep)
-			}
-			for _, oEntry := range o.ManifestEntries {
-				m.replaceManifestEntry(oEntry)
-			}
-		}
-	}
-
-	return nil
+	return m, nil
 }
 
 func (m *Manifest) RootDir() string {
@@ -180,63 +154,15 @@ func (m *Manifest) Version() (string, error) {
 func (m *Manifest) CheckStackSupport() error {
 	requiredStack := os.Getenv("CF_STACK")
 
-	if m.manifestSupportsStack(requiredStack) {
+	if m.ForStack(requiredStack).Supported() {
 		return nil
 	}
 
 	return fmt.Errorf("required stack %s was not found", requiredStack)
 }
 
-func (m *Manifest) manifestSupportsStack(stack string) bool {
-	if m.Stack != "" {
-		return m.Stack == stack
-	}
-
-	if len(m.ManifestEntries) == 0 {
-		return true
-	}
-
-	for _, entry := range m.ManifestEntries {
-		if m.entrySupportsStack(&entry, stack) {
-			return true
-		}
-	}
-
-	return false
-}
-
 func (m *Manifest) DefaultVersion(depName string) (Dependency, error) {
-	var defaultVersion string
-	var err error
-	numDefaults := 0
-
-	for _, defaultDep := range m.DefaultVersions {
-		if depName == defaultDep.Name {
-			defaultVersion = defaultDep.Version
-			numDefaults++
-		}
-	}
-
-	if numDefaults == 0 {
-		err = fmt.Errorf("no default version for %s", depName)
-	} else if numDefaults > 1 {
-		err = fmt.Errorf("found %d default versions for %s", numDefaults, depName)
-	}
-
-	if err != nil {
-		m.log.Error(defaultVersionsError)
-		return Dependency{}, err
-	}
-
-	depVersions := m.AllDependencyVersions(depName)
-	highestVersion, err := FindMatchingVersion(defaultVersion, depVersions)
-
-	if err != nil {
-		m.log.Error(defaultVersionsError)
-		return Dependency{}, err
-	}
-
-	return Dependency{Name: depName, Version: highestVersion}, nil
+	return m.currentStack().DefaultVersion(depName)
 }
 
 func fetchCachedBuildpackDependency(entry *ManifestEntry, outputFile, manifestRootDir string, manifestLog *Logger) error {
@@ -245,73 +171,75 @@ func fetchCachedBuildpackDependency(entry *ManifestEntry, outputFile, manifestRo
 		source = filepath.Join(manifestRootDir, source)
 	}
 	manifestLog.Info("Copy [%s]", source)
-	if err := CopyFile(source, outputFile); err != nil {
-		return err
-	}
-	return deleteBadFile(entry, outputFile)
+	return copyAndVerify(entry, source, outputFile, manifestLog)
 }
 
-func deleteBadFile(entry *ManifestEntry, outputFile string) error {
-	if err := checkSha256(outputFile, entry.SHA256); err != nil {
+func deleteBadFile(digest *entryDigest, outputFile string) error {
+	if err := digest.verify(); err != nil {
 		os.Remove(outputFile)
 		return err
 	}
 	return nil
 }
 
-func downloadDependency(entry *ManifestEntry, outputFile string, logger *Logger) error {
-	filteredURI, err := filterURI(entry.URI)
+// downloadDependency fetches the entry from its mirrored URI, still checking it
+// against the digests of the entry
+func (m *Manifest) downloadDependency(client *http.Client, entry *ManifestEntry, outputFile string, opts DownloadOptions) error {
+	uri, err := m.MirroredURI(entry.URI)
 	if err != nil {
 		return err
 	}
-	logger.Info("Download [%s]", filteredURI)
-	err = downloadFile(entry.URI, outputFile)
+	filteredURI, err := filterURI(uri)
 	if err != nil {
 		return err
 	}
-
-	return deleteBadFile(entry, outputFile)
-}
-
-func (m *Manifest) entrySupportsStack(entry *ManifestEntry, stack string) bool {
-
-	if m.Stack != "" {
-		return m.Stack == stack
+	m.log.Info("Download [%s]", filteredURI)
+	if uri != entry.URI {
+		if filteredOriginal, err := filterURI(entry.URI); err == nil {
+			m.log.Debug("Mirror of [%s]", filteredOriginal)
+		}
 	}
 
-	for _, s := range entry.CFStacks {
-		if s == stack {
-			return true
-		}
+	digest := newEntryDigest(entry)
+	err = downloadFile(client, uri, outputFile, opts, digest, m.log.Progress("Downloading", 0))
+	if err != nil {
+		return err
 	}
 
-	return false
+	return deleteBadFile(digest, outputFile)
+}
+
+// currentStack is the view of the manifest for the stack staging runs on
+func (m *Manifest) currentStack() *StackManifest {
+	return m.ForStack(os.Getenv("CF_STACK"))
 }
 
 func (m *Manifest) AllDependencyVersions(depName string) []string {
-	var depVersions []string
-	currentStack := os.Getenv("CF_STACK")
+	return m.currentStack().AllDependencyVersions(depName)
+}
 
-	for _, e := range m.ManifestEntries {
-		if e.Dependency.Name == depName && m.entrySupportsStack(&e, currentStack) {
-			depVersions = append(depVersions, e.Dependency.Version)
-		}
-	}
+func (m *Manifest) GetEntry(dep Dependency) (*ManifestEntry, error) {
+	return m.currentStack().GetEntry(dep)
+}
 
-	return depVersions
+// Licenses lists the licenses declared by the dependencies for the current stack
+func (m *Manifest) Licenses() []string {
+	return m.currentStack().Licenses()
 }
 
-func (m *Manifest) GetEntry(dep Dependency) (*ManifestEntry, error) {
-	currentStack := os.Getenv("CF_STACK")
+// EntriesWithLicense lists the dependencies for the current stack declaring license
+func (m *Manifest) EntriesWithLicense(license string) []ManifestEntry {
+	return m.currentStack().EntriesWithLicense(license)
+}
 
-	for _, e := range m.ManifestEntries {
-		if e.Dependency == dep && m.entrySupportsStack(&e, currentStack) {
-			return &e, nil
-		}
-	}
+// GetEntryByPURL finds the dependency for the current stack with package URL purl
+func (m *Manifest) GetEntryByPURL(purl string) (*ManifestEntry, error) {
+	return m.currentStack().GetEntryByPURL(purl)
+}
 
-	m.log.Error(dependencyMissingError(m, dep))
-	return nil, fmt.Errorf("dependency %s %s not found", dep.Name, dep.Version)
+// GetEntryByCPE finds the dependency for the current stack with CPE name cpe
+func (m *Manifest) GetEntryByCPE(cpe string) (*ManifestEntry, error) {
+	return m.currentStack().GetEntryByCPE(cpe)
 }
 
 func (m *Manifest) IsCached() bool {
@@ -0,0 +1,114 @@
+package libbuildpack
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/semver"
+)
+
+// DeprecationPolicy decides what installing a dependency of a deprecated
+// version line does. The zero policy warns 30 days before the date of the
+// deprecation and after it.
+type DeprecationPolicy struct {
+	// WarnDays is how many days before its date a deprecation is warned about
+	WarnDays int `yaml:"warn_days,omitempty"`
+	// FailAfterEOL makes installing a version line past its date an error
+	FailAfterEOL bool `yaml:"fail_after_eol,omitempty"`
+	// OptInEnv names an environment variable that, set to true, allows
+	// installing a version line past its date despite FailAfterEOL
+	OptInEnv string `yaml:"opt_in_env,omitempty"`
+}
+
+func (p DeprecationPolicy) warnWithin() time.Duration {
+	if p.WarnDays <= 0 {
+		return thirtyDays
+	}
+	return time.Duration(p.WarnDays) * 24 * time.Hour
+}
+
+func (p DeprecationPolicy) optedIn() bool {
+	if p.OptInEnv == "" {
+		return false
+	}
+	optIn, _ := strconv.ParseBool(os.Getenv(p.OptInEnv))
+	return optIn
+}
+
+// DeprecationsOf lists the deprecations of the version lines dep belongs to
+func (m *Manifest) DeprecationsOf(dep Dependency) []DeprecationDate {
+	matchVersion := func(versionLine, depVersion string) bool {
+		return versionLine == depVersion
+	}
+
+	v, err := semver.NewVersion(dep.Version)
+	if err == nil {
+		matchVersion = func(versionLine, depVersion string) bool {
+			constraint, err := semver.NewConstraint(versionLine)
+			if err != nil {
+				return false
+			}
+
+			return constraint.Check(v)
+		}
+	}
+
+	var deprecations []DeprecationDate
+	for _, deprecation := range m.Deprecations {
+		if deprecation.Name == dep.Name && matchVersion(deprecation.VersionLine, dep.Version) {
+			deprecations = append(deprecations, deprecation)
+		}
+	}
+	return deprecations
+}
+
+// UpcomingDeprecations lists the deprecations dated after now, and no later
+// than within from now unless within is zero, earliest first
+func (m *Manifest) UpcomingDeprecations(now time.Time, within time.Duration) ([]DeprecationDate, error) {
+	var upcoming []DeprecationDate
+	dates := map[string]time.Time{}
+	for _, deprecation := range m.Deprecations {
+		eolTime, err := time.Parse(dateFormat, deprecation.Date)
+		if err != nil {
+			return nil, err
+		}
+		if eolTime.Before(now) || (within > 0 && eolTime.Sub(now) > within) {
+			continue
+		}
+		dates[deprecation.Date] = eolTime
+		upcoming = append(upcoming, deprecation)
+	}
+
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return dates[upcoming[i].Date].Before(dates[upcoming[j].Date])
+	})
+	return upcoming, nil
+}
+
+// CheckDeprecation applies the deprecation policy of the manifest to
+// installing dep: it warns within the warning window and past the date of a
+// deprecation, or fails past the date if the policy says so.
+func (m *Manifest) CheckDeprecation(dep Dependency) error {
+	policy := m.DeprecationPolicy
+
+	for _, deprecation := range m.DeprecationsOf(dep) {
+		eolTime, err := time.Parse(dateFormat, deprecation.Date)
+		if err != nil {
+			return err
+		}
+
+		pastEOL := !m.currentTime.Before(eolTime)
+		if pastEOL && policy.FailAfterEOL && !policy.optedIn() {
+			m.log.Error("%s", endOfLifeError(dep, deprecation, policy.OptInEnv))
+			return fmt.Errorf("%s %s reached its end of life on %s", dep.Name, deprecation.VersionLine, deprecation.Date)
+		}
+
+		if eolTime.Sub(m.currentTime) < policy.warnWithin() {
+			m.log.Warning("%s", endOfLifeWarning(dep.Name, deprecation.VersionLine, deprecation.Date, deprecation.Link))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package libbuildpack_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Deprecations", func() {
+	var (
+		manifest    *libbuildpack.Manifest
+		buffer      *bytes.Buffer
+		currentTime time.Time
+		oldCfStack  string
+		oldOptIn    string
+	)
+
+	BeforeEach(func() {
+		oldCfStack = os.Getenv("CF_STACK")
+		Expect(os.Setenv("CF_STACK", "cflinuxfs4")).To(Succeed())
+		oldOptIn = os.Getenv("BP_ALLOW_EOL_DEPENDENCIES")
+		Expect(os.Unsetenv("BP_ALLOW_EOL_DEPENDENCIES")).To(Succeed())
+
+		buffer = new(bytes.Buffer)
+		currentTime = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	})
+	AfterEach(func() {
+		Expect(os.Setenv("CF_STACK", oldCfStack)).To(Succeed())
+		Expect(os.Setenv("BP_ALLOW_EOL_DEPENDENCIES", oldOptIn)).To(Succeed())
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		manifest, err = libbuildpack.NewManifest(filepath.Join("fixtures", "manifest", "deprecations"), libbuildpack.NewLogger(buffer), currentTime)
+		Expect(err).To(BeNil())
+	})
+
+	It("reads the policy from manifest.yml", func() {
+		Expect(manifest.DeprecationPolicy).To(Equal(libbuildpack.DeprecationPolicy{
+			WarnDays:     90,
+			FailAfterEOL: true,
+			OptInEnv:     "BP_ALLOW_EOL_DEPENDENCIES",
+		}))
+	})
+
+	It("finds the deprecations of a dependency", func() {
+		deprecations := manifest.DeprecationsOf(libbuildpack.Dependency{Name: "thing", Version: "1.2.3"})
+		Expect(deprecations).To(HaveLen(1))
+		Expect(deprecations[0].Date).To(Equal("2030-03-01"))
+
+		Expect(manifest.DeprecationsOf(libbuildpack.Dependency{Name: "thing", Version: "3.0.0"})).To(BeEmpty())
+	})
+
+	It("lists upcoming deprecations, earliest first", func() {
+		upcoming, err := manifest.UpcomingDeprecations(currentTime, 0)
+		Expect(err).To(BeNil())
+		Expect(upcoming).To(HaveLen(3))
+		Expect(upcoming[0].Date).To(Equal("2030-03-01"))
+		Expect(upcoming[1].Name).To(Equal("other_thing"))
+		Expect(upcoming[2].Date).To(Equal("2030-09-01"))
+
+		upcoming, err = manifest.UpcomingDeprecations(currentTime, 180*24*time.Hour)
+		Expect(err).To(BeNil())
+		Expect(upcoming).To(HaveLen(2))
+
+		upcoming, err = manifest.UpcomingDeprecations(time.Date(2030, 7, 1, 0, 0, 0, 0, time.UTC), 0)
+		Expect(err).To(BeNil())
+		Expect(upcoming).To(HaveLen(1))
+	})
+
+	Context("within the warning window", func() {
+		It("warns", func() {
+			Expect(manifest.CheckDeprecation(libbuildpack.Dependency{Name: "thing", Version: "1.2.3"})).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("thing 1.x will no longer be available in new buildpacks released after 2030-03-01."))
+		})
+
+		It("does not warn about later deprecations", func() {
+			Expect(manifest.CheckDeprecation(libbuildpack.Dependency{Name: "thing", Version: "2.0.0"})).To(Succeed())
+			Expect(buffer.String()).To(BeEmpty())
+		})
+	})
+
+	Context("past the end of life", func() {
+		BeforeEach(func() { currentTime = time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC) })
+
+		It("fails", func() {
+			err := manifest.CheckDeprecation(libbuildpack.Dependency{Name: "thing", Version: "1.2.3"})
+			Expect(err).To(MatchError("thing 1.x reached its end of life on 2030-03-01"))
+			Expect(buffer.String()).To(ContainSubstring("Set BP_ALLOW_EOL_DEPENDENCIES=true to install it anyway."))
+		})
+
+		It("does not download the dependency", func() {
+			installer := libbuildpack.NewInstaller(manifest)
+			err := installer.InstallDependency(libbuildpack.Dependency{Name: "thing", Version: "1.2.3"}, os.TempDir())
+			Expect(err).To(MatchError("thing 1.x reached its end of life on 2030-03-01"))
+			Expect(buffer.String()).NotTo(ContainSubstring("Download"))
+		})
+
+		It("warns when opted in", func() {
+			Expect(os.Setenv("BP_ALLOW_EOL_DEPENDENCIES", "true")).To(Succeed())
+
+			Expect(manifest.CheckDeprecation(libbuildpack.Dependency{Name: "thing", Version: "1.2.3"})).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("thing 1.x will no longer be available"))
+		})
+
+		It("warns without fail_after_eol", func() {
+			manifest.DeprecationPolicy = libbuildpack.DeprecationPolicy{}
+
+			Expect(manifest.CheckDeprecation(libbuildpack.Dependency{Name: "thing", Version: "1.2.3"})).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("thing 1.x will no longer be available"))
+		})
+	})
+})
@@ -0,0 +1,276 @@
+package libbuildpack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ManifestFile edits a manifest as text, so that comments and formatting of
+// the parts it does not change are kept
+type ManifestFile struct {
+	path     string
+	lines    []string
+	manifest Manifest
+}
+
+// OpenManifestFile reads the manifest at path for editing. The manifests it
+// includes are not read.
+func OpenManifestFile(path string) (*ManifestFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &ManifestFile{path: path, lines: strings.Split(string(data), "\n")}
+	if err := f.parse(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Manifest is the manifest as edited so far
+func (f *ManifestFile) Manifest() *Manifest {
+	return &f.manifest
+}
+
+func (f *ManifestFile) String() string {
+	return strings.Join(f.lines, "\n")
+}
+
+// Save writes the edited manifest back to its file
+func (f *ManifestFile) Save() error {
+	return ioutil.WriteFile(f.path, []byte(f.String()), 0644)
+}
+
+func (f *ManifestFile) parse() error {
+	var m Manifest
+	if err := yaml.Unmarshal([]byte(f.String()), &m); err != nil {
+		return fmt.Errorf("could not parse %s: %v", f.path, err)
+	}
+	f.manifest = m
+	return nil
+}
+
+// AddDependency inserts entry before the first dependency that sorts after it
+// according to less, or else at the end of the dependencies
+func (f *ManifestFile) AddDependency(entry ManifestEntry, less func(a, b ManifestEntry) bool) error {
+	for _, e := range f.manifest.ManifestEntries {
+		if e.Dependency != entry.Dependency {
+			continue
+		}
+		for _, stack := range entry.CFStacks {
+			if containsString(e.CFStacks, stack) {
+				return fmt.Errorf("dependency %s %s for stack %s is already in %s", entry.Name, entry.Version, stack, f.path)
+			}
+		}
+	}
+
+	ranges := f.itemRanges("dependencies")
+	at, indent := f.sectionEnd("dependencies"), 0
+	for idx, e := range f.manifest.ManifestEntries {
+		if idx < len(ranges) && less(entry, e) {
+			at = ranges[idx].start
+			break
+		}
+	}
+	if len(ranges) > 0 {
+		indent = ranges[0].indent
+	}
+
+	item, err := yamlItem(entry, indent)
+	if err != nil {
+		return err
+	}
+	return f.insert("dependencies", at, item)
+}
+
+// RemoveDependency removes every entry of dep, for all stacks
+func (f *ManifestFile) RemoveDependency(dep Dependency) error {
+	ranges := f.itemRanges("dependencies")
+
+	removed := false
+	for idx := len(f.manifest.ManifestEntries) - 1; idx >= 0; idx-- {
+		if f.manifest.ManifestEntries[idx].Dependency == dep && idx < len(ranges) {
+			f.lines = append(f.lines[:ranges[idx].start], f.lines[ranges[idx].end:]...)
+			removed = true
+		}
+	}
+	if !removed {
+		return fmt.Errorf("dependency %s %s is not in %s", dep.Name, dep.Version, f.path)
+	}
+	return f.parse()
+}
+
+// ReplaceDependency removes every entry of dep like RemoveDependency, but
+// moves the comments before them to the first entry of with, so that the
+// comments survive e.g. a newer version replacing an older one
+func (f *ManifestFile) ReplaceDependency(dep, with Dependency) error {
+	ranges := f.itemRanges("dependencies")
+
+	var comments []string
+	removed := false
+	for idx := len(f.manifest.ManifestEntries) - 1; idx >= 0; idx-- {
+		if f.manifest.ManifestEntries[idx].Dependency == dep && idx < len(ranges) {
+			r := ranges[idx]
+			comments = append(append([]string{}, f.lines[r.start:r.item]...), comments...)
+			f.lines = append(f.lines[:r.start], f.lines[r.end:]...)
+			removed = true
+		}
+	}
+	if !removed {
+		return fmt.Errorf("dependency %s %s is not in %s", dep.Name, dep.Version, f.path)
+	}
+	if err := f.parse(); err != nil {
+		return err
+	}
+
+	ranges = f.itemRanges("dependencies")
+	for idx, e := range f.manifest.ManifestEntries {
+		if e.Dependency == with && idx < len(ranges) {
+			return f.insert("dependencies", ranges[idx].start, comments)
+		}
+	}
+	return fmt.Errorf("dependency %s %s is not in %s", with.Name, with.Version, f.path)
+}
+
+var versionLinePattern = regexp.MustCompile(`^(\s*(?:-\s+)?version:\s*)([^#]*?)(\s*(?:#.*)?)$`)
+
+// SetDefaultVersion changes the default version of name, or adds one
+func (f *ManifestFile) SetDefaultVersion(name, version string) error {
+	value, err := yaml.Marshal(version)
+	if err != nil {
+		return err
+	}
+	scalar := strings.TrimSpace(string(value))
+
+	ranges := f.itemRanges("default_versions")
+	for idx, d := range f.manifest.DefaultVersions {
+		if d.Name != name || idx >= len(ranges) {
+			continue
+		}
+		for line := ranges[idx].start; line < ranges[idx].end; line++ {
+			if match := versionLinePattern.FindStringSubmatch(f.lines[line]); match != nil {
+				f.lines[line] = match[1] + scalar + match[3]
+				return f.parse()
+			}
+		}
+		return fmt.Errorf("default version of %s in %s has no version", name, f.path)
+	}
+
+	indent := 0
+	if len(ranges) > 0 {
+		indent = ranges[0].indent
+	}
+	item, err := yamlItem(Dependency{Name: name, Version: version}, indent)
+	if err != nil {
+		return err
+	}
+	return f.insert("default_versions", f.sectionEnd("default_versions"), item)
+}
+
+var blockHeaderPattern = regexp.MustCompile(`^[A-Za-z0-9_]+:\s*(#.*)?$`)
+
+// insert adds lines at index at of section, adding the section if needed
+func (f *ManifestFile) insert(section string, at int, lines []string) error {
+	if header := f.sectionStart(section); header == -1 {
+		lines = append([]string{section + ":"}, lines...)
+	} else if !blockHeaderPattern.MatchString(f.lines[header]) {
+		return fmt.Errorf("cannot edit %s of %s, it is not a block list", section, f.path)
+	}
+
+	f.lines = append(f.lines[:at], append(lines, f.lines[at:]...)...)
+	return f.parse()
+}
+
+func yamlItem(value interface{}, indent int) ([]string, error) {
+	data, err := yaml.Marshal([]interface{}{value})
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for idx := range lines {
+		lines[idx] = strings.Repeat(" ", indent) + lines[idx]
+	}
+	return lines, nil
+}
+
+type lineRange struct {
+	start, end int // indexes of f.lines, end excluded
+	item       int // index of the line of the item, after its comments
+	indent     int
+}
+
+// sectionStart is the index of the line of the top level key section, or -1
+func (f *ManifestFile) sectionStart(section string) int {
+	for idx, line := range f.lines {
+		if match := yamlKeyPattern.FindStringSubmatch(line); match != nil && match[1] == section {
+			return idx
+		}
+	}
+	return -1
+}
+
+// sectionEnd is the index after the last item of section, or the end of the
+// file if there is no such section. Comments before the next key belong to it.
+func (f *ManifestFile) sectionEnd(section string) int {
+	start := f.sectionStart(section)
+	if start == -1 {
+		end := len(f.lines)
+		for end > 0 && strings.TrimSpace(f.lines[end-1]) == "" {
+			end--
+		}
+		return end
+	}
+
+	end := len(f.lines)
+	for idx := start + 1; idx < len(f.lines); idx++ {
+		line := f.lines[idx]
+		if line != "" && line[0] != ' ' && line[0] != '-' && line[0] != '#' {
+			end = idx
+			break
+		}
+	}
+	return f.skipBack(start+1, end)
+}
+
+// skipBack moves end back over the blank lines and comments just before it
+func (f *ManifestFile) skipBack(start, end int) int {
+	for end > start {
+		trimmed := strings.TrimSpace(f.lines[end-1])
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		end--
+	}
+	return end
+}
+
+// itemRanges are the lines of each list item of section, including the
+// comments just before the item
+func (f *ManifestFile) itemRanges(section string) []lineRange {
+	items := scanManifestLines([]byte(f.String()))[section]
+	end := f.sectionEnd(section)
+
+	ranges := make([]lineRange, len(items))
+	for idx := len(items) - 1; idx >= 0; idx-- {
+		start := items[idx].line - 1
+		line := f.lines[start]
+		ranges[idx] = lineRange{end: end, item: start, indent: len(line) - len(strings.TrimLeft(line, " "))}
+
+		previous := f.sectionStart(section) + 1
+		if idx > 0 {
+			previous = items[idx-1].line
+		}
+		for start > previous && strings.HasPrefix(strings.TrimSpace(f.lines[start-1]), "#") {
+			start--
+		}
+		ranges[idx].start = start
+		end = start
+	}
+	return ranges
+}
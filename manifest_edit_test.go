@@ -0,0 +1,175 @@
+package libbuildpack_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ManifestFile", func() {
+	var (
+		tmpDir       string
+		manifestFile string
+		f            *libbuildpack.ManifestFile
+	)
+
+	byNameAndVersion := func(a, b libbuildpack.ManifestEntry) bool {
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "manifest-edit")
+		Expect(err).To(BeNil())
+
+		manifestFile = filepath.Join(tmpDir, "manifest.yml")
+		Expect(libbuildpack.CopyFile(filepath.Join("fixtures", "manifest", "edit", "manifest.yml"), manifestFile)).To(Succeed())
+
+		f, err = libbuildpack.OpenManifestFile(manifestFile)
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	saved := func() string {
+		Expect(f.Save()).To(Succeed())
+		data, err := ioutil.ReadFile(manifestFile)
+		Expect(err).To(BeNil())
+		return string(data)
+	}
+
+	It("adds dependencies in sorted order keeping comments", func() {
+		Expect(f.AddDependency(libbuildpack.ManifestEntry{
+			Dependency: libbuildpack.Dependency{Name: "ruby", Version: "3.1.4"},
+			URI:        "https://example.com/ruby-3.1.4.tgz",
+			SHA256:     "dddd",
+			CFStacks:   []string{"cflinuxfs4"},
+		}, byNameAndVersion)).To(Succeed())
+		Expect(f.AddDependency(libbuildpack.ManifestEntry{
+			Dependency: libbuildpack.Dependency{Name: "yarn", Version: "1.22.19"},
+			URI:        "https://example.com/yarn-1.22.19.tgz",
+			SHA256:     "eeee",
+			CFStacks:   []string{"cflinuxfs4"},
+		}, byNameAndVersion)).To(Succeed())
+
+		Expect(saved()).To(Equal(`---
+language: ruby
+
+# the default versions are kept in sync with the release notes
+default_versions:
+- name: ruby
+  version: 3.1.x # see dependency_deprecation_dates
+- name: bundler
+  version: 2.4.10
+
+dependencies:
+# bundler is installed with every ruby
+- name: bundler
+  version: 2.4.10
+  uri: https://example.com/bundler-2.4.10.tgz
+  sha256: aaaa
+  cf_stacks:
+  - cflinuxfs4
+- name: ruby
+  version: 3.1.3
+  uri: https://example.com/ruby-3.1.3.tgz
+  sha256: bbbb
+  cf_stacks:
+  - cflinuxfs4
+- name: ruby
+  version: 3.1.4
+  uri: https://example.com/ruby-3.1.4.tgz
+  sha256: dddd
+  cf_stacks:
+  - cflinuxfs4
+# the newest ruby
+- name: ruby
+  version: 3.2.2
+  uri: https://example.com/ruby-3.2.2.tgz
+  sha256: cccc
+  cf_stacks:
+  - cflinuxfs4
+- name: yarn
+  version: 1.22.19
+  uri: https://example.com/yarn-1.22.19.tgz
+  sha256: eeee
+  cf_stacks:
+  - cflinuxfs4
+
+# end of the dependencies
+include_files:
+- manifest.yml
+`))
+		Expect(f.Manifest().ManifestEntries).To(HaveLen(5))
+	})
+
+	It("does not add a dependency twice for a stack", func() {
+		err := f.AddDependency(libbuildpack.ManifestEntry{
+			Dependency: libbuildpack.Dependency{Name: "ruby", Version: "3.1.3"},
+			CFStacks:   []string{"cflinuxfs4"},
+		}, byNameAndVersion)
+		Expect(err).To(MatchError(ContainSubstring("dependency ruby 3.1.3 for stack cflinuxfs4 is already in")))
+	})
+
+	It("removes dependencies with the comments before them", func() {
+		Expect(f.RemoveDependency(libbuildpack.Dependency{Name: "ruby", Version: "3.2.2"})).To(Succeed())
+		Expect(f.RemoveDependency(libbuildpack.Dependency{Name: "bundler", Version: "2.4.10"})).To(Succeed())
+
+		Expect(saved()).To(ContainSubstring(`
+dependencies:
+- name: ruby
+  version: 3.1.3
+  uri: https://example.com/ruby-3.1.3.tgz
+  sha256: bbbb
+  cf_stacks:
+  - cflinuxfs4
+
+# end of the dependencies
+include_files:
+`))
+		Expect(f.RemoveDependency(libbuildpack.Dependency{Name: "ruby", Version: "3.2.2"})).To(MatchError(ContainSubstring("dependency ruby 3.2.2 is not in")))
+	})
+
+	It("moves the comments of replaced dependencies to their replacement", func() {
+		Expect(f.ReplaceDependency(
+			libbuildpack.Dependency{Name: "ruby", Version: "3.2.2"},
+			libbuildpack.Dependency{Name: "ruby", Version: "3.1.3"},
+		)).To(Succeed())
+
+		Expect(saved()).To(ContainSubstring(`
+  - cflinuxfs4
+# the newest ruby
+- name: ruby
+  version: 3.1.3
+`))
+		Expect(f.Manifest().ManifestEntries).To(HaveLen(2))
+	})
+
+	It("changes and adds default versions", func() {
+		Expect(f.SetDefaultVersion("ruby", "3.2.x")).To(Succeed())
+		Expect(f.SetDefaultVersion("yarn", "1.22.19")).To(Succeed())
+
+		Expect(saved()).To(ContainSubstring(`
+# the default versions are kept in sync with the release notes
+default_versions:
+- name: ruby
+  version: 3.2.x # see dependency_deprecation_dates
+- name: bundler
+  version: 2.4.10
+- name: yarn
+  version: 1.22.19
+
+dependencies:
+`))
+		Expect(f.Manifest().DefaultVersions).To(ContainElement(libbuildpack.Dependency{Name: "yarn", Version: "1.22.19"}))
+	})
+})
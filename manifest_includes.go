@@ -0,0 +1,183 @@
+package libbuildpack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ManifestDir holds manifests next to manifest.yml that are merged into it,
+// like the files listed under includes:
+const ManifestDir = "manifest.d"
+
+// includableKeys are the only keys an included manifest may have
+var includableKeys = []string{"dependencies", "default_versions", "dependency_deprecation_dates"}
+
+type manifestPart struct {
+	file     string // relative to the directory of manifest.yml
+	data     []byte
+	manifest Manifest
+}
+
+// ReadManifest reads the manifest.yml of bpDir merged with the manifests it
+// includes. Included dependencies are added to those of manifest.yml; a
+// dependency defined in two files for the same stack is an error. Default
+// versions and deprecations of manifest.yml take precedence over included
+// ones, which must not conflict with each other.
+func ReadManifest(bpDir string) (*Manifest, error) {
+	parts, err := readManifestParts(filepath.Join(bpDir, "manifest.yml"))
+	if err != nil {
+		return nil, err
+	}
+	return mergeManifestParts(parts)
+}
+
+// IncludedManifests lists the manifests ReadManifest merges into the
+// manifest.yml of bpDir, relative to bpDir
+func IncludedManifests(bpDir string) ([]string, error) {
+	parts, err := readManifestParts(filepath.Join(bpDir, "manifest.yml"))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, part := range parts[1:] {
+		files = append(files, part.file)
+	}
+	return files, nil
+}
+
+func readManifestParts(file string) ([]manifestPart, error) {
+	dir := filepath.Dir(file)
+
+	main, err := readManifestPart(dir, filepath.Base(file))
+	if err != nil {
+		return nil, err
+	}
+	parts := []manifestPart{main}
+
+	var files []string
+	for _, include := range main.manifest.Includes {
+		matches, err := filepath.Glob(filepath.Join(dir, include))
+		if err != nil {
+			return nil, fmt.Errorf("invalid include %s: %v", include, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("included manifest %s not found", include)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, ManifestDir, "*.yml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	files = append(files, matches...)
+
+	seen := map[string]bool{main.file: true}
+	for _, match := range files {
+		name, err := filepath.Rel(dir, match)
+		if err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		part, err := readManifestPart(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range part.manifest.raw {
+			if key := fmt.Sprint(item.Key); !containsString(includableKeys, key) {
+				return nil, fmt.Errorf("%s: %s cannot be included, only %s", name, key, strings.Join(includableKeys, ", "))
+			}
+		}
+		parts = append(parts, part)
+	}
+
+	return parts, nil
+}
+
+func readManifestPart(dir, name string) (manifestPart, error) {
+	part := manifestPart{file: name}
+
+	var err error
+	part.data, err = ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return part, err
+	}
+	if err := yaml.Unmarshal(part.data, &part.manifest); err != nil {
+		return part, fmt.Errorf("could not parse %s: %v", name, err)
+	}
+	return part, nil
+}
+
+func mergeManifestParts(parts []manifestPart) (*Manifest, error) {
+	m := parts[0].manifest
+	if len(parts) == 1 {
+		return &m, nil
+	}
+	m.Includes = nil
+
+	definedIn := map[string]string{}
+	for _, part := range parts {
+		for _, e := range part.manifest.ManifestEntries {
+			stacks := e.CFStacks
+			if len(stacks) == 0 {
+				stacks = []string{m.Stack}
+			}
+			for _, stack := range stacks {
+				key := strings.Join([]string{e.Name, e.Version, stack, e.Arch, e.OS}, " ")
+				if first, ok := definedIn[key]; ok && first != part.file {
+					return nil, fmt.Errorf("dependency %s %s for stack %s%s is defined in %s and %s", e.Name, e.Version, stack, platformSuffix(e), first, part.file)
+				}
+				definedIn[key] = part.file
+			}
+		}
+	}
+
+	defaults := map[string]string{}
+	for _, d := range m.DefaultVersions {
+		defaults[d.Name] = parts[0].file
+	}
+	deprecations := map[string]string{}
+	for _, d := range m.Deprecations {
+		deprecations[d.Name+" "+d.VersionLine] = parts[0].file
+	}
+
+	for _, part := range parts[1:] {
+		m.ManifestEntries = append(m.ManifestEntries, part.manifest.ManifestEntries...)
+
+		for _, d := range part.manifest.DefaultVersions {
+			first, ok := defaults[d.Name]
+			if ok && first != parts[0].file {
+				return nil, fmt.Errorf("default version of %s is defined in %s and %s", d.Name, first, part.file)
+			}
+			if !ok {
+				defaults[d.Name] = part.file
+				m.DefaultVersions = append(m.DefaultVersions, d)
+			}
+		}
+
+		for _, d := range part.manifest.Deprecations {
+			key := d.Name + " " + d.VersionLine
+			first, ok := deprecations[key]
+			if ok && first != parts[0].file {
+				return nil, fmt.Errorf("deprecation of %s %s is defined in %s and %s", d.Name, d.VersionLine, first, part.file)
+			}
+			if !ok {
+				deprecations[key] = part.file
+				m.Deprecations = append(m.Deprecations, d)
+			}
+		}
+	}
+
+	return &m, nil
+}
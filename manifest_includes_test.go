@@ -0,0 +1,98 @@
+package libbuildpack_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Included manifests", func() {
+	var oldCfStack string
+
+	BeforeEach(func() {
+		oldCfStack = os.Getenv("CF_STACK")
+		Expect(os.Setenv("CF_STACK", "cflinuxfs2")).To(Succeed())
+	})
+	AfterEach(func() { Expect(os.Setenv("CF_STACK", oldCfStack)).To(Succeed()) })
+
+	It("merges includes and manifest.d into the manifest", func() {
+		manifest, err := libbuildpack.NewManifest(filepath.Join("fixtures", "manifest", "includes"), nil, time.Now())
+		Expect(err).To(BeNil())
+
+		Expect(manifest.AllDependencyVersions("thing")).To(Equal([]string{"2.0.0", "1.0.0"}))
+		Expect(manifest.AllDependencyVersions("other_thing")).To(Equal([]string{"3.1.0"}))
+		Expect(manifest.Deprecations).To(HaveLen(1))
+		Expect(manifest.Includes).To(BeEmpty())
+	})
+
+	It("prefers the default versions of manifest.yml", func() {
+		manifest, err := libbuildpack.NewManifest(filepath.Join("fixtures", "manifest", "includes"), nil, time.Now())
+		Expect(err).To(BeNil())
+
+		Expect(manifest.DefaultVersion("thing")).To(Equal(libbuildpack.Dependency{Name: "thing", Version: "2.0.0"}))
+		Expect(manifest.DefaultVersion("other_thing")).To(Equal(libbuildpack.Dependency{Name: "other_thing", Version: "3.1.0"}))
+	})
+
+	It("lists the manifests it includes", func() {
+		Expect(libbuildpack.IncludedManifests(filepath.Join("fixtures", "manifest", "includes"))).To(Equal([]string{
+			filepath.Join("deps", "thing.yml"),
+			filepath.Join("manifest.d", "other_thing.yml"),
+		}))
+	})
+
+	Context("included files conflict", func() {
+		var bpDir string
+
+		BeforeEach(func() {
+			var err error
+			bpDir, err = ioutil.TempDir("", "includes")
+			Expect(err).To(BeNil())
+			Expect(libbuildpack.CopyDirectory(filepath.Join("fixtures", "manifest", "includes"), bpDir)).To(Succeed())
+		})
+		AfterEach(func() { Expect(os.RemoveAll(bpDir)).To(Succeed()) })
+
+		It("rejects a dependency defined in two files", func() {
+			data, err := ioutil.ReadFile(filepath.Join(bpDir, "deps", "thing.yml"))
+			Expect(err).To(BeNil())
+			Expect(ioutil.WriteFile(filepath.Join(bpDir, libbuildpack.ManifestDir, "thing.yml"), data, 0644)).To(Succeed())
+
+			_, err = libbuildpack.ReadManifest(bpDir)
+			Expect(err).To(MatchError("dependency thing 1.0.0 for stack cflinuxfs2 is defined in deps/thing.yml and manifest.d/thing.yml"))
+
+			problems, err := libbuildpack.ValidateManifest(filepath.Join(bpDir, "manifest.yml"))
+			Expect(err).To(BeNil())
+			Expect(problems).To(ConsistOf(libbuildpack.ManifestProblem{
+				File:    filepath.Join(bpDir, "manifest.d", "thing.yml"),
+				Line:    6,
+				Message: "dependency thing 1.0.0 is defined more than once for stack cflinuxfs2 (first in " + filepath.Join(bpDir, "deps", "thing.yml") + " on line 6)",
+			}))
+		})
+
+		It("rejects default versions defined in two included files", func() {
+			Expect(ioutil.WriteFile(filepath.Join(bpDir, libbuildpack.ManifestDir, "extra.yml"), []byte("default_versions:\n- name: other_thing\n  version: 2.x\n"), 0644)).To(Succeed())
+
+			_, err := libbuildpack.ReadManifest(bpDir)
+			Expect(err).To(MatchError("default version of other_thing is defined in manifest.d/extra.yml and manifest.d/other_thing.yml"))
+		})
+
+		It("only includes dependencies, defaults and deprecations", func() {
+			Expect(ioutil.WriteFile(filepath.Join(bpDir, libbuildpack.ManifestDir, "language.yml"), []byte("language: other\n"), 0644)).To(Succeed())
+
+			_, err := libbuildpack.ReadManifest(bpDir)
+			Expect(err).To(MatchError("manifest.d/language.yml: language cannot be included, only dependencies, default_versions, dependency_deprecation_dates"))
+		})
+
+		It("fails on missing includes", func() {
+			Expect(os.RemoveAll(filepath.Join(bpDir, "deps"))).To(Succeed())
+
+			_, err := libbuildpack.ReadManifest(bpDir)
+			Expect(err).To(MatchError("included manifest deps/*.yml not found"))
+		})
+	})
+})
@@ -0,0 +1,388 @@
+package libbuildpack
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// Override is the part of an override.yml for one language. Its
+// default_versions, dependencies and dependency_mirrors are added like those
+// of Add, which is how override.yml has always worked.
+type Override struct {
+	DefaultVersions   []Dependency       `yaml:"default_versions,omitempty"`
+	ManifestEntries   []ManifestEntry    `yaml:"dependencies,omitempty"`
+	DependencyMirrors []DependencyMirror `yaml:"dependency_mirrors,omitempty"`
+	Add               OverrideAdd        `yaml:"add,omitempty"`
+	Remove            OverrideRemove     `yaml:"remove,omitempty"`
+	Patch             OverridePatch      `yaml:"patch,omitempty"`
+}
+
+// OverrideAdd replaces the default versions with the same name, the
+// dependencies with the same name, version and platform and the deprecation
+// dates with the same name and version line, and adds the others. Its
+// dependency mirrors take precedence over the ones already there.
+type OverrideAdd struct {
+	DefaultVersions   []Dependency       `yaml:"default_versions,omitempty"`
+	ManifestEntries   []ManifestEntry    `yaml:"dependencies,omitempty"`
+	Deprecations      []DeprecationDate  `yaml:"dependency_deprecation_dates,omitempty"`
+	DependencyMirrors []DependencyMirror `yaml:"dependency_mirrors,omitempty"`
+}
+
+// OverrideRemove removes default versions by name, dependencies by selector,
+// deprecation dates by name and version line, where an empty one selects
+// every one, and dependency mirrors by match
+type OverrideRemove struct {
+	DefaultVersions   []string             `yaml:"default_versions,omitempty"`
+	ManifestEntries   []DependencySelector `yaml:"dependencies,omitempty"`
+	Deprecations      []DeprecationDate    `yaml:"dependency_deprecation_dates,omitempty"`
+	DependencyMirrors []string             `yaml:"dependency_mirrors,omitempty"`
+}
+
+// OverridePatch changes the dependencies that are already in the manifest
+type OverridePatch struct {
+	ManifestEntries []DependencyPatch `yaml:"dependencies,omitempty"`
+}
+
+// DependencySelector selects dependencies by name and version, where the
+// version may also be a constraint such as 1.7.x or "< 2". An empty name or
+// version selects every name or version.
+type DependencySelector struct {
+	Name    string `yaml:"name,omitempty"`
+	Version string `yaml:"version,omitempty"`
+}
+
+// DependencyPatch changes the dependencies it selects
+type DependencyPatch struct {
+	DependencySelector `yaml:",inline"`
+	// AllowedVersions removes the selected dependencies outside of this constraint
+	AllowedVersions string `yaml:"allowed_versions,omitempty"`
+	// URI rewrites the uri of the selected dependencies like a dependency mirror
+	URI      DependencyMirror `yaml:"uri,omitempty"`
+	CFStacks []string         `yaml:"cf_stacks,omitempty"`
+}
+
+// OverrideChange is a change ApplyOverride made to the manifest
+type OverrideChange struct {
+	File        string
+	Description string
+}
+
+func (c OverrideChange) String() string {
+	return fmt.Sprintf("%s: %s", c.File, c.Description)
+}
+
+func (s DependencySelector) matches(name, version string) bool {
+	if s.Name != "" && s.Name != name {
+		return false
+	}
+	if s.Version == "" || s.Version == version {
+		return true
+	}
+	return versionAllowed(s.Version, version)
+}
+
+func versionAllowed(constraint, version string) bool {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	return c.Check(v)
+}
+
+// overrideFiles are the override.yml files of depsDir, in the order of the
+// index of the supply buildpack that wrote them
+func overrideFiles(depsDir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(depsDir, "*", "override.yml"))
+	if err != nil {
+		return nil, err
+	}
+
+	index := func(file string) (int, error) {
+		return strconv.Atoi(filepath.Base(filepath.Dir(file)))
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		a, errA := index(files[i])
+		b, errB := index(files[j])
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		if errA == nil || errB == nil {
+			return errA == nil
+		}
+		return files[i] < files[j]
+	})
+	return files, nil
+}
+
+func loadOverrides(file string) (map[string]Override, error) {
+	var overrideYml map[string]Override
+	y := &YAML{}
+	if err := y.Load(file, &overrideYml); err != nil {
+		return nil, err
+	}
+	return overrideYml, nil
+}
+
+// ApplyOverride applies the override.yml files the supply buildpacks wrote to
+// depsDir for the language of the manifest, in the order of the buildpacks so
+// that later ones win. Each file removes, then adds, then patches, and every
+// change is logged and kept in OverrideChanges.
+func (m *Manifest) ApplyOverride(depsDir string) error {
+	files, err := overrideFiles(depsDir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		overrideYml, err := loadOverrides(file)
+		if err != nil {
+			return err
+		}
+
+		if o, found := overrideYml[m.Language()]; found {
+			if err := m.applyOverride(file, o); err != nil {
+				return fmt.Errorf("could not apply %s: %v", file, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// OverrideChanges lists the changes made by ApplyOverride, in order
+func (m *Manifest) OverrideChanges() []OverrideChange {
+	return m.overrideChanges
+}
+
+func (m *Manifest) applyOverride(file string, o Override) error {
+	name := filepath.Join(filepath.Base(filepath.Dir(file)), "override.yml")
+	changed := func(format string, args ...interface{}) {
+		change := OverrideChange{File: name, Description: fmt.Sprintf(format, args...)}
+		m.overrideChanges = append(m.overrideChanges, change)
+		if m.log != nil {
+			m.log.Info("%s", change)
+		}
+	}
+
+	m.applyRemove(o.Remove, changed)
+
+	add := o.Add
+	add.DefaultVersions = append(o.DefaultVersions, add.DefaultVersions...)
+	add.ManifestEntries = append(o.ManifestEntries, add.ManifestEntries...)
+	add.DependencyMirrors = append(o.DependencyMirrors, add.DependencyMirrors...)
+	m.applyAdd(add, changed)
+
+	return m.applyPatch(o.Patch, changed)
+}
+
+func (m *Manifest) applyRemove(r OverrideRemove, changed func(string, ...interface{})) {
+	for _, name := range r.DefaultVersions {
+		var kept []Dependency
+		for _, d := range m.DefaultVersions {
+			if d.Name == name {
+				changed("removed default version %s %s", d.Name, d.Version)
+				continue
+			}
+			kept = append(kept, d)
+		}
+		m.DefaultVersions = kept
+	}
+
+	for _, s := range r.ManifestEntries {
+		var kept []ManifestEntry
+		for _, e := range m.ManifestEntries {
+			if s.matches(e.Name, e.Version) {
+				changed("removed dependency %s %s%s", e.Name, e.Version, entryStacks(e))
+				continue
+			}
+			kept = append(kept, e)
+		}
+		m.ManifestEntries = kept
+	}
+
+	for _, s := range r.Deprecations {
+		var kept []DeprecationDate
+		for _, d := range m.Deprecations {
+			if (s.Name == "" || s.Name == d.Name) && (s.VersionLine == "" || s.VersionLine == d.VersionLine) {
+				changed("removed deprecation date of %s %s", d.Name, d.VersionLine)
+				continue
+			}
+			kept = append(kept, d)
+		}
+		m.Deprecations = kept
+	}
+
+	for _, match := range r.DependencyMirrors {
+		var kept []DependencyMirror
+		for _, mirror := range m.DependencyMirrors {
+			if mirror.Match == match {
+				changed("removed dependency mirror of %s", mirror.Match)
+				continue
+			}
+			kept = append(kept, mirror)
+		}
+		m.DependencyMirrors = kept
+	}
+}
+
+func (m *Manifest) applyAdd(a OverrideAdd, changed func(string, ...interface{})) {
+	for _, oDep := range a.DefaultVersions {
+		m.replaceDefaultVersion(oDep, changed)
+	}
+	for _, oEntry := range a.ManifestEntries {
+		m.replaceManifestEntry(oEntry, changed)
+	}
+	for _, oDate := range a.Deprecations {
+		m.replaceDeprecation(oDate, changed)
+	}
+	for _, mirror := range a.DependencyMirrors {
+		changed("added dependency mirror %s of %s", mirror.Mirror, mirror.Match)
+	}
+	m.DependencyMirrors = append(append([]DependencyMirror{}, a.DependencyMirrors...), m.DependencyMirrors...)
+}
+
+func (m *Manifest) applyPatch(p OverridePatch, changed func(string, ...interface{})) error {
+	for _, patch := range p.ManifestEntries {
+		if patch.AllowedVersions != "" {
+			if _, err := semver.NewConstraint(patch.AllowedVersions); err != nil {
+				return fmt.Errorf("invalid allowed_versions %s: %v", patch.AllowedVersions, err)
+			}
+		}
+
+		var kept []ManifestEntry
+		for _, e := range m.ManifestEntries {
+			if !patch.matches(e.Name, e.Version) {
+				kept = append(kept, e)
+				continue
+			}
+			if patch.AllowedVersions != "" && !versionAllowed(patch.AllowedVersions, e.Version) {
+				changed("removed dependency %s %s%s, it is not in %s", e.Name, e.Version, entryStacks(e), patch.AllowedVersions)
+				continue
+			}
+			if uri, ok := patch.URI.rewrite(e.URI); ok && uri != e.URI {
+				changed("changed uri of %s %s to %s", e.Name, e.Version, uri)
+				e.URI = uri
+			}
+			if len(patch.CFStacks) > 0 {
+				changed("changed stacks of %s %s to %s", e.Name, e.Version, strings.Join(patch.CFStacks, ", "))
+				e.CFStacks = patch.CFStacks
+			}
+			kept = append(kept, e)
+		}
+		m.ManifestEntries = kept
+	}
+	return nil
+}
+
+func (m *Manifest) replaceDefaultVersion(oDep Dependency, changed func(string, ...interface{})) {
+	for idx, mDep := range m.DefaultVersions {
+		if mDep.Name == oDep.Name {
+			changed("changed default version of %s from %s to %s", oDep.Name, mDep.Version, oDep.Version)
+			m.DefaultVersions[idx] = oDep
+			return
+		}
+	}
+	changed("added default version %s %s", oDep.Name, oDep.Version)
+	m.DefaultVersions = append(m.DefaultVersions, oDep)
+}
+
+// replaceManifestEntry replaces the stacks oEntry has of the entries with
+// the same name, version and platform. The entries keep their other stacks;
+// an entry or override without stacks covers every stack.
+func (m *Manifest) replaceManifestEntry(oEntry ManifestEntry, changed func(string, ...interface{})) {
+	replaced := false
+	var kept []ManifestEntry
+	for _, mEntry := range m.ManifestEntries {
+		if !sameEntry(mEntry, oEntry) {
+			kept = append(kept, mEntry)
+			continue
+		}
+
+		if !replaced {
+			kept = append(kept, oEntry)
+			replaced = true
+		}
+		changed("replaced dependency %s %s%s", mEntry.Name, mEntry.Version, entryStacks(overlap(mEntry, oEntry)))
+
+		if remaining := remainingStacks(mEntry, oEntry); len(remaining) > 0 {
+			mEntry.CFStacks = remaining
+			changed("kept dependency %s %s%s", mEntry.Name, mEntry.Version, entryStacks(mEntry))
+			kept = append(kept, mEntry)
+		}
+	}
+	if !replaced {
+		changed("added dependency %s %s%s", oEntry.Name, oEntry.Version, entryStacks(oEntry))
+		kept = append(kept, oEntry)
+	}
+	m.ManifestEntries = kept
+}
+
+func sameEntry(a, b ManifestEntry) bool {
+	if a.Dependency != b.Dependency || a.Arch != b.Arch || a.OS != b.OS {
+		return false
+	}
+	return len(a.CFStacks) == 0 || len(b.CFStacks) == 0 || len(overlap(a, b).CFStacks) > 0
+}
+
+// overlap is entry limited to the stacks it shares with override
+func overlap(entry, override ManifestEntry) ManifestEntry {
+	if len(override.CFStacks) == 0 {
+		return entry
+	}
+	if len(entry.CFStacks) == 0 {
+		entry.CFStacks = override.CFStacks
+		return entry
+	}
+
+	var stacks []string
+	for _, stack := range entry.CFStacks {
+		if containsString(override.CFStacks, stack) {
+			stacks = append(stacks, stack)
+		}
+	}
+	entry.CFStacks = stacks
+	return entry
+}
+
+// remainingStacks are the stacks of entry that override does not replace
+func remainingStacks(entry, override ManifestEntry) []string {
+	if len(override.CFStacks) == 0 {
+		return nil
+	}
+
+	var stacks []string
+	for _, stack := range entry.CFStacks {
+		if !containsString(override.CFStacks, stack) {
+			stacks = append(stacks, stack)
+		}
+	}
+	return stacks
+}
+
+func (m *Manifest) replaceDeprecation(oDate DeprecationDate, changed func(string, ...interface{})) {
+	for idx, mDate := range m.Deprecations {
+		if mDate.Name == oDate.Name && mDate.VersionLine == oDate.VersionLine {
+			changed("changed deprecation date of %s %s to %s", oDate.Name, oDate.VersionLine, oDate.Date)
+			m.Deprecations[idx] = oDate
+			return
+		}
+	}
+	changed("added deprecation date %s of %s %s", oDate.Date, oDate.Name, oDate.VersionLine)
+	m.Deprecations = append(m.Deprecations, oDate)
+}
+
+func entryStacks(e ManifestEntry) string {
+	if len(e.CFStacks) == 0 {
+		return ""
+	}
+	return " for " + strings.Join(e.CFStacks, ", ")
+}
@@ -0,0 +1,194 @@
+package libbuildpack_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Override", func() {
+	var (
+		depsDir  string
+		buffer   *bytes.Buffer
+		manifest *libbuildpack.Manifest
+	)
+
+	writeOverride := func(index, data string) {
+		Expect(os.MkdirAll(filepath.Join(depsDir, index), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(depsDir, index, "override.yml"), []byte(data), 0644)).To(Succeed())
+	}
+
+	versions := func(name string) []string {
+		var versions []string
+		for _, e := range manifest.ManifestEntries {
+			if e.Name == name {
+				versions = append(versions, e.Version)
+			}
+		}
+		return versions
+	}
+
+	BeforeEach(func() {
+		var err error
+		depsDir, err = ioutil.TempDir("", "override")
+		Expect(err).To(BeNil())
+
+		buffer = new(bytes.Buffer)
+		manifest, err = libbuildpack.NewManifest(filepath.Join("fixtures", "manifest", "override"), libbuildpack.NewLogger(ansicleaner.New(buffer)), time.Now())
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+	})
+
+	It("applies the files in the order of the supply buildpacks", func() {
+		writeOverride("10", "ruby:\n  default_versions:\n  - name: ruby\n    version: 3.2.x\n")
+		writeOverride("2", "ruby:\n  default_versions:\n  - name: ruby\n    version: 3.0.x\n")
+
+		Expect(manifest.ApplyOverride(depsDir)).To(Succeed())
+
+		Expect(manifest.DefaultVersions[0]).To(Equal(libbuildpack.Dependency{Name: "ruby", Version: "3.2.x"}))
+		Expect(manifest.OverrideChanges()).To(Equal([]libbuildpack.OverrideChange{
+			{File: filepath.Join("2", "override.yml"), Description: "changed default version of ruby from 3.1.x to 3.0.x"},
+			{File: filepath.Join("10", "override.yml"), Description: "changed default version of ruby from 3.0.x to 3.2.x"},
+		}))
+		Expect(buffer.String()).To(ContainSubstring("10/override.yml: changed default version of ruby from 3.0.x to 3.2.x"))
+
+		version, err := libbuildpack.OverrideVersionSource(depsDir, "ruby").Version("ruby")
+		Expect(err).To(BeNil())
+		Expect(version).To(Equal("3.2.x"))
+	})
+
+	It("replaces dependencies with the ones of the override", func() {
+		writeOverride("0", `ruby:
+  dependencies:
+  - name: ruby
+    version: 3.2.2
+    uri: https://internal.example.org/ruby-3.2.2.tgz
+    sha256: dddd
+    cf_stacks: [cflinuxfs4]
+`)
+
+		Expect(manifest.ApplyOverride(depsDir)).To(Succeed())
+
+		Expect(versions("ruby")).To(Equal([]string{"3.1.3", "3.2.2"}))
+		Expect(manifest.ManifestEntries[2].URI).To(Equal("https://internal.example.org/ruby-3.2.2.tgz"))
+		Expect(manifest.ManifestEntries[2].SHA256).To(Equal("dddd"))
+		Expect(manifest.OverrideChanges()[0].Description).To(Equal("replaced dependency ruby 3.2.2 for cflinuxfs4"))
+	})
+
+	It("only replaces the stacks the override shares with a dependency", func() {
+		writeOverride("0", `ruby:
+  dependencies:
+  - name: ruby
+    version: 3.1.3
+    uri: https://internal.example.org/ruby-3.1.3.tgz
+    sha256: dddd
+    cf_stacks: [cflinuxfs4]
+`)
+
+		Expect(manifest.ApplyOverride(depsDir)).To(Succeed())
+
+		Expect(manifest.ManifestEntries[1].URI).To(Equal("https://internal.example.org/ruby-3.1.3.tgz"))
+		Expect(manifest.ManifestEntries[1].CFStacks).To(Equal([]string{"cflinuxfs4"}))
+		Expect(manifest.ManifestEntries[2].URI).To(Equal("https://example.com/ruby-3.1.3.tgz"))
+		Expect(manifest.ManifestEntries[2].CFStacks).To(Equal([]string{"cflinuxfs3"}))
+		Expect(manifest.OverrideChanges()).To(Equal([]libbuildpack.OverrideChange{
+			{File: filepath.Join("0", "override.yml"), Description: "replaced dependency ruby 3.1.3 for cflinuxfs4"},
+			{File: filepath.Join("0", "override.yml"), Description: "kept dependency ruby 3.1.3 for cflinuxfs3"},
+		}))
+	})
+
+	It("replaces every dependency the override shares a stack with", func() {
+		writeOverride("0", "ruby:\n  dependencies:\n  - name: ruby\n    version: 3.1.3\n    uri: https://a.example.org/ruby.tgz\n    cf_stacks: [cflinuxfs4]\n")
+		writeOverride("1", "ruby:\n  dependencies:\n  - name: ruby\n    version: 3.1.3\n    uri: https://b.example.org/ruby.tgz\n    cf_stacks: [cflinuxfs3, cflinuxfs4]\n")
+
+		Expect(manifest.ApplyOverride(depsDir)).To(Succeed())
+
+		Expect(versions("ruby")).To(Equal([]string{"3.1.3", "3.2.2"}))
+		Expect(manifest.ManifestEntries[1].URI).To(Equal("https://b.example.org/ruby.tgz"))
+		Expect(manifest.ManifestEntries[1].CFStacks).To(Equal([]string{"cflinuxfs3", "cflinuxfs4"}))
+	})
+
+	It("removes, adds and patches every section", func() {
+		writeOverride("0", `ruby:
+  remove:
+    default_versions: [node]
+    dependencies:
+    - name: node
+    dependency_deprecation_dates:
+    - name: ruby
+      version_line: 3.1.x
+    dependency_mirrors: [example.com]
+  add:
+    dependencies:
+    - name: ruby
+      version: 3.3.0
+      uri: https://example.com/ruby-3.3.0.tgz
+      sha256: eeee
+      cf_stacks: [cflinuxfs4]
+    dependency_deprecation_dates:
+    - name: ruby
+      version_line: 3.2.x
+      date: 2026-03-31
+    dependency_mirrors:
+    - match: https://example.com/
+      mirror: https://internal.example.org/
+  patch:
+    dependencies:
+    - name: ruby
+      allowed_versions: ">= 3.2"
+    - uri:
+        match: example.com
+        mirror: https://static.example.org
+    - name: ruby
+      version: 3.3.x
+      cf_stacks: [cflinuxfs4, cflinuxfs5]
+`)
+
+		Expect(manifest.ApplyOverride(depsDir)).To(Succeed())
+
+		Expect(manifest.DefaultVersions).To(Equal([]libbuildpack.Dependency{{Name: "ruby", Version: "3.1.x"}}))
+		Expect(versions("node")).To(BeEmpty())
+		Expect(versions("ruby")).To(Equal([]string{"3.2.2", "3.3.0"}))
+		Expect(manifest.ManifestEntries[0].URI).To(Equal("https://static.example.org/ruby-3.2.2.tgz"))
+		Expect(manifest.ManifestEntries[1].CFStacks).To(Equal([]string{"cflinuxfs4", "cflinuxfs5"}))
+		Expect(manifest.Deprecations).To(HaveLen(1))
+		Expect(manifest.Deprecations[0].VersionLine).To(Equal("3.2.x"))
+		Expect(manifest.DependencyMirrors).To(Equal([]libbuildpack.DependencyMirror{
+			{Match: "https://example.com/", Mirror: "https://internal.example.org/"},
+		}))
+
+		var descriptions []string
+		for _, change := range manifest.OverrideChanges() {
+			descriptions = append(descriptions, change.Description)
+		}
+		Expect(descriptions).To(Equal([]string{
+			"removed default version node 18.x",
+			"removed dependency node 18.17.1 for cflinuxfs4",
+			"removed deprecation date of ruby 3.1.x",
+			"removed dependency mirror of example.com",
+			"added dependency ruby 3.3.0 for cflinuxfs4",
+			"added deprecation date 2026-03-31 of ruby 3.2.x",
+			"added dependency mirror https://internal.example.org/ of https://example.com/",
+			"removed dependency ruby 3.1.3 for cflinuxfs3, cflinuxfs4, it is not in >= 3.2",
+			"changed uri of ruby 3.2.2 to https://static.example.org/ruby-3.2.2.tgz",
+			"changed uri of ruby 3.3.0 to https://static.example.org/ruby-3.3.0.tgz",
+			"changed stacks of ruby 3.3.0 to cflinuxfs4, cflinuxfs5",
+		}))
+	})
+
+	It("fails on an invalid allowed version range", func() {
+		writeOverride("0", "ruby:\n  patch:\n    dependencies:\n    - name: ruby\n      allowed_versions: not a range\n")
+
+		Expect(manifest.ApplyOverride(depsDir)).To(MatchError(ContainSubstring("invalid allowed_versions not a range")))
+	})
+})
@@ -0,0 +1,168 @@
+package libbuildpack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	semver2 "github.com/Masterminds/semver"
+)
+
+// Resolution explains how a version constraint of a dependency was resolved
+// to an entry of the manifest
+type Resolution struct {
+	Name       string
+	Constraint string
+	Stack      string
+	// Entry is the highest matching entry, nil if no version matched
+	Entry *ManifestEntry
+	// Considered are the versions provided for the stack, lowest first
+	Considered []string
+	// Filtered are the entries of the dependency for other stacks, arches or
+	// operating systems
+	Filtered []ManifestEntry
+	// Matched are the considered versions satisfying the constraint, lowest first
+	Matched []string
+}
+
+// Resolve finds the highest version of depName for the current stack that
+// satisfies constraint
+func (m *Manifest) Resolve(depName, constraint string) (*Resolution, error) {
+	return m.currentStack().Resolve(depName, constraint)
+}
+
+// Resolve finds the highest version of depName for the stack that satisfies
+// constraint. The resolution is returned, explaining the failure, even if no
+// version matched.
+func (s *StackManifest) Resolve(depName, constraint string) (*Resolution, error) {
+	r := &Resolution{Name: depName, Constraint: constraint, Stack: s.stack}
+
+	for _, e := range s.manifest.ManifestEntries {
+		if e.Name != depName {
+			continue
+		}
+		if !s.supports(&e) {
+			r.Filtered = append(r.Filtered, e)
+		} else if !containsString(r.Considered, e.Version) {
+			r.Considered = append(r.Considered, e.Version)
+		}
+	}
+	sortVersions(r.Considered)
+
+	if len(r.Considered) == 0 {
+		return r, fmt.Errorf("dependency %s is not provided for stack %s", depName, s.stack)
+	}
+
+	matched, err := FindMatchingVersions(constraint, r.Considered)
+	if err != nil {
+		return r, fmt.Errorf("no version of %s for stack %s matches %s", depName, s.stack, constraint)
+	}
+	r.Matched = matched
+
+	winner := matched[len(matched)-1]
+	for _, e := range s.manifest.ManifestEntries {
+		if e.Name == depName && e.Version == winner && s.supports(&e) {
+			r.Entry = &e
+			break
+		}
+	}
+
+	return r, nil
+}
+
+// Explain describes the resolution in a few lines, for logs and errors
+func (r *Resolution) Explain() string {
+	var lines []string
+
+	if r.Entry != nil {
+		lines = append(lines, fmt.Sprintf("%s %s resolved to %s for stack %s: highest of the matching versions %s",
+			r.Name, r.Constraint, r.Entry.Version, r.Stack, strings.Join(r.Matched, ", ")))
+	} else {
+		lines = append(lines, fmt.Sprintf("%s %s did not resolve for stack %s", r.Name, r.Constraint, r.Stack))
+	}
+
+	if len(r.Considered) > 0 {
+		lines = append(lines, fmt.Sprintf("considered versions: %s", strings.Join(r.Considered, ", ")))
+	} else {
+		lines = append(lines, "no versions are provided for the stack")
+	}
+
+	if len(r.Filtered) > 0 {
+		var filtered []string
+		for _, e := range r.Filtered {
+			filtered = append(filtered, fmt.Sprintf("%s (%s)", e.Version, entryPlatform(e)))
+		}
+		lines = append(lines, fmt.Sprintf("ignored versions for other platforms: %s", strings.Join(filtered, ", ")))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Nearest lists up to n of the considered versions closest to the constraint,
+// lowest first
+func (r *Resolution) Nearest(n int) []string {
+	if len(r.Considered) <= n {
+		return r.Considered
+	}
+
+	// start at the first version above the requested one, and widen around it
+	requested, err := semver2.NewVersion(constraintVersion(r.Constraint))
+	pos := len(r.Considered)
+	if err == nil {
+		for idx, version := range r.Considered {
+			if v, err := semver2.NewVersion(version); err == nil && v.GreaterThan(requested) {
+				pos = idx
+				break
+			}
+		}
+	}
+
+	low, high := pos, pos
+	for high-low < n {
+		if low > 0 && (high >= len(r.Considered) || pos-low <= high-pos) {
+			low--
+		} else {
+			high++
+		}
+	}
+	return r.Considered[low:high]
+}
+
+// constraintVersion is the version a simple constraint such as ~1.2 or 1.2.x
+// is written around
+func constraintVersion(constraint string) string {
+	version := strings.TrimLeft(strings.TrimSpace(constraint), "=~^<>v ")
+	version = strings.NewReplacer("x", "0", "X", "0", "*", "0").Replace(version)
+	return version
+}
+
+// entryPlatform names the stacks, arch and os an entry is provided for
+func entryPlatform(e ManifestEntry) string {
+	platform := strings.Join(e.CFStacks, ", ")
+	if e.OS != "" {
+		platform += " " + e.OS
+	}
+	if e.Arch != "" {
+		platform += " " + e.Arch
+	}
+	if platform = strings.TrimSpace(platform); platform == "" {
+		return "another stack"
+	}
+	return platform
+}
+
+// sortVersions sorts semantic versions, and the others alphabetically after them
+func sortVersions(versions []string) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		vi, ei := semver2.NewVersion(versions[i])
+		vj, ej := semver2.NewVersion(versions[j])
+		switch {
+		case ei == nil && ej == nil:
+			return vi.LessThan(vj)
+		case ei == nil || ej == nil:
+			return ei == nil
+		default:
+			return versions[i] < versions[j]
+		}
+	})
+}
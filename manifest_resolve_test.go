@@ -0,0 +1,83 @@
+package libbuildpack_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resolve", func() {
+	var (
+		manifest   *libbuildpack.Manifest
+		buffer     *bytes.Buffer
+		oldCfStack string
+	)
+
+	BeforeEach(func() {
+		oldCfStack = os.Getenv("CF_STACK")
+		Expect(os.Setenv("CF_STACK", "cflinuxfs4")).To(Succeed())
+
+		var err error
+		buffer = new(bytes.Buffer)
+		manifest, err = libbuildpack.NewManifest(filepath.Join("fixtures", "manifest", "resolve"), libbuildpack.NewLogger(buffer), time.Now())
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() { Expect(os.Setenv("CF_STACK", oldCfStack)).To(Succeed()) })
+
+	It("returns the highest matching entry", func() {
+		resolution, err := manifest.Resolve("node", "18.x")
+		Expect(err).To(BeNil())
+
+		Expect(resolution.Entry.Version).To(Equal("18.17.1"))
+		Expect(resolution.Entry.URI).To(Equal("https://example.com/dependencies/node-18.17.1-linux-x64.tgz"))
+		Expect(resolution.Matched).To(Equal([]string{"18.16.0", "18.17.1"}))
+		Expect(resolution.Considered).To(Equal([]string{"16.20.0", "18.16.0", "18.17.1", "20.5.0", "20.6.0"}))
+		Expect(resolution.Filtered).To(HaveLen(1))
+	})
+
+	It("explains the decision", func() {
+		resolution, err := manifest.Resolve("node", "18.x")
+		Expect(err).To(BeNil())
+
+		Expect(resolution.Explain()).To(Equal("node 18.x resolved to 18.17.1 for stack cflinuxfs4: highest of the matching versions 18.16.0, 18.17.1\n" +
+			"considered versions: 16.20.0, 18.16.0, 18.17.1, 20.5.0, 20.6.0\n" +
+			"ignored versions for other platforms: 14.21.3 (cflinuxfs3)"))
+	})
+
+	It("resolves for another stack", func() {
+		resolution, err := manifest.ForStack("cflinuxfs3").Resolve("node", "*")
+		Expect(err).To(BeNil())
+		Expect(resolution.Entry.Version).To(Equal("18.17.1"))
+		Expect(resolution.Considered).To(Equal([]string{"14.21.3", "18.17.1"}))
+	})
+
+	Context("no version matches", func() {
+		It("returns the resolution with the nearest versions", func() {
+			resolution, err := manifest.Resolve("node", "19.x")
+			Expect(err).To(MatchError("no version of node for stack cflinuxfs4 matches 19.x"))
+			Expect(resolution.Entry).To(BeNil())
+			Expect(resolution.Nearest(2)).To(Equal([]string{"18.17.1", "20.5.0"}))
+			Expect(resolution.Nearest(3)).To(Equal([]string{"18.16.0", "18.17.1", "20.5.0"}))
+		})
+
+		It("reports a dependency that is not provided", func() {
+			_, err := manifest.Resolve("python", "3.x")
+			Expect(err).To(MatchError("dependency python is not provided for stack cflinuxfs4"))
+		})
+
+		It("shows the nearest versions and other stacks in the missing dependency error", func() {
+			_, err := manifest.GetEntry(libbuildpack.Dependency{Name: "node", Version: "14.21.3"})
+			Expect(err).To(HaveOccurred())
+
+			Expect(buffer.String()).To(ContainSubstring("The versions of node supported in this buildpack nearest to 14.21.3 are:"))
+			Expect(buffer.String()).To(ContainSubstring("- 16.20.0"))
+			Expect(buffer.String()).To(ContainSubstring("Version 14.21.3 is only provided for cflinuxfs3."))
+		})
+	})
+})
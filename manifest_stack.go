@@ -0,0 +1,236 @@
+package libbuildpack
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"sort"
+)
+
+// StackManifest answers questions about the dependencies a manifest provides
+// for a single stack and platform. The query methods of Manifest answer them
+// for CF_STACK.
+type StackManifest struct {
+	manifest *Manifest
+	stack    string
+	arch     string
+	os       string
+}
+
+// ForStack returns the view of the manifest for stack on the architecture and
+// operating system the buildpack runs on
+func (m *Manifest) ForStack(stack string) *StackManifest {
+	return &StackManifest{manifest: m, stack: stack, arch: runtime.GOARCH, os: runtime.GOOS}
+}
+
+// WithArch returns the view for arch, an empty arch matches every dependency
+func (s *StackManifest) WithArch(arch string) *StackManifest {
+	view := *s
+	view.arch = arch
+	return &view
+}
+
+// WithOS returns the view for os, an empty os matches every dependency
+func (s *StackManifest) WithOS(os string) *StackManifest {
+	view := *s
+	view.os = os
+	return &view
+}
+
+// StackMatches reports whether cfStack, an entry of cf_stacks, names stack:
+// literally, as a wildcard such as cflinuxfs* or as one of stack_aliases
+func (m *Manifest) StackMatches(cfStack, stack string) bool {
+	if cfStack == stack {
+		return true
+	}
+	if matched, err := path.Match(cfStack, stack); err == nil && matched {
+		return true
+	}
+	for _, aliased := range m.StackAliases[cfStack] {
+		if aliased == stack {
+			return true
+		}
+		if matched, err := path.Match(aliased, stack); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *StackManifest) Stack() string {
+	return s.stack
+}
+
+func (s *StackManifest) Arch() string {
+	return s.arch
+}
+
+func (s *StackManifest) OS() string {
+	return s.os
+}
+
+// Supported is false when none of the dependencies are provided for the stack
+func (s *StackManifest) Supported() bool {
+	m := s.manifest
+	if m.Stack != "" {
+		return m.Stack == s.stack
+	}
+
+	if len(m.ManifestEntries) == 0 {
+		return true
+	}
+
+	for _, e := range m.ManifestEntries {
+		if s.supports(&e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *StackManifest) supports(entry *ManifestEntry) bool {
+	if !entry.SupportsPlatform(s.os, s.arch) {
+		return false
+	}
+
+	m := s.manifest
+	if m.Stack != "" {
+		return m.Stack == s.stack
+	}
+
+	for _, cfStack := range entry.CFStacks {
+		if m.StackMatches(cfStack, s.stack) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SupportsPlatform is true unless the entry is limited to another arch or os.
+// An empty goos or goarch matches every entry.
+func (e *ManifestEntry) SupportsPlatform(goos, goarch string) bool {
+	if e.Arch != "" && goarch != "" && e.Arch != goarch {
+		return false
+	}
+	return e.OS == "" || goos == "" || e.OS == goos
+}
+
+// Entries lists the dependencies provided for the stack
+func (s *StackManifest) Entries() []ManifestEntry {
+	var entries []ManifestEntry
+	for _, e := range s.manifest.ManifestEntries {
+		if s.supports(&e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func (s *StackManifest) AllDependencyVersions(depName string) []string {
+	var depVersions []string
+
+	for _, e := range s.manifest.ManifestEntries {
+		if e.Dependency.Name == depName && s.supports(&e) {
+			depVersions = append(depVersions, e.Dependency.Version)
+		}
+	}
+
+	return depVersions
+}
+
+func (s *StackManifest) GetEntry(dep Dependency) (*ManifestEntry, error) {
+	for _, e := range s.manifest.ManifestEntries {
+		if e.Dependency == dep && s.supports(&e) {
+			return &e, nil
+		}
+	}
+
+	s.manifest.log.Error("%s", dependencyMissingError(s, dep))
+	return nil, fmt.Errorf("dependency %s %s not found", dep.Name, dep.Version)
+}
+
+func (s *StackManifest) DefaultVersion(depName string) (Dependency, error) {
+	m := s.manifest
+	var defaultVersion string
+	var err error
+	numDefaults := 0
+
+	for _, defaultDep := range m.DefaultVersions {
+		if depName == defaultDep.Name {
+			defaultVersion = defaultDep.Version
+			numDefaults++
+		}
+	}
+
+	if numDefaults == 0 {
+		err = fmt.Errorf("no default version for %s", depName)
+	} else if numDefaults > 1 {
+		err = fmt.Errorf("found %d default versions for %s", numDefaults, depName)
+	}
+
+	if err != nil {
+		m.log.Error(defaultVersionsError)
+		return Dependency{}, err
+	}
+
+	depVersions := s.AllDependencyVersions(depName)
+	highestVersion, err := FindMatchingVersion(defaultVersion, depVersions)
+
+	if err != nil {
+		m.log.Error(defaultVersionsError)
+		return Dependency{}, err
+	}
+
+	return Dependency{Name: depName, Version: highestVersion}, nil
+}
+
+// Licenses lists the licenses declared by the dependencies for the stack
+func (s *StackManifest) Licenses() []string {
+	var licenses []string
+	for _, e := range s.Entries() {
+		for _, license := range e.Licenses {
+			if !containsString(licenses, license) {
+				licenses = append(licenses, license)
+			}
+		}
+	}
+	sort.Strings(licenses)
+
+	return licenses
+}
+
+// EntriesWithLicense lists the dependencies for the stack declaring license
+func (s *StackManifest) EntriesWithLicense(license string) []ManifestEntry {
+	var entries []ManifestEntry
+	for _, e := range s.Entries() {
+		if containsString(e.Licenses, license) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// GetEntryByPURL finds the dependency for the stack with package URL purl
+func (s *StackManifest) GetEntryByPURL(purl string) (*ManifestEntry, error) {
+	for _, e := range s.Entries() {
+		if e.PURL == purl {
+			return &e, nil
+		}
+	}
+
+	return nil, fmt.Errorf("dependency with purl %s not found", purl)
+}
+
+// GetEntryByCPE finds the dependency for the stack with CPE name cpe
+func (s *StackManifest) GetEntryByCPE(cpe string) (*ManifestEntry, error) {
+	for _, e := range s.Entries() {
+		if e.CPE == cpe {
+			return &e, nil
+		}
+	}
+
+	return nil, fmt.Errorf("dependency with cpe %s not found", cpe)
+}
@@ -0,0 +1,87 @@
+package libbuildpack_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ForStack", func() {
+	var (
+		manifest   *libbuildpack.Manifest
+		oldCfStack string
+	)
+
+	BeforeEach(func() {
+		oldCfStack = os.Getenv("CF_STACK")
+		Expect(os.Setenv("CF_STACK", "jammy")).To(Succeed())
+
+		var err error
+		logger := libbuildpack.NewLogger(&bytes.Buffer{})
+		manifest, err = libbuildpack.NewManifest(filepath.Join("fixtures", "manifest", "stack-wildcards"), logger, time.Now())
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() { Expect(os.Setenv("CF_STACK", oldCfStack)).To(Succeed()) })
+
+	It("queries another stack than CF_STACK", func() {
+		Expect(manifest.AllDependencyVersions("thing")).To(BeEmpty())
+		Expect(manifest.ForStack("cflinuxfs3").AllDependencyVersions("thing")).To(Equal([]string{"1.0.0", "2.0.0"}))
+		Expect(manifest.ForStack("jammy").WithOS("linux").AllDependencyVersions("other_thing")).To(Equal([]string{"3.1.0"}))
+	})
+
+	It("matches wildcards in cf_stacks", func() {
+		stack := manifest.ForStack("cflinuxfs4")
+		Expect(stack.AllDependencyVersions("thing")).To(Equal([]string{"2.0.0"}))
+
+		entry, err := stack.GetEntry(libbuildpack.Dependency{Name: "thing", Version: "2.0.0"})
+		Expect(err).To(BeNil())
+		Expect(entry.URI).To(Equal("https://example.com/dependencies/thing-2.0.0-linux-x64.tgz"))
+
+		_, err = stack.GetEntry(libbuildpack.Dependency{Name: "thing", Version: "1.0.0"})
+		Expect(err).To(MatchError("dependency thing 1.0.0 not found"))
+	})
+
+	It("matches stack aliases in cf_stacks", func() {
+		Expect(manifest.StackMatches("bionic-based", "cflinuxfs3")).To(BeTrue())
+		Expect(manifest.StackMatches("bionic-based", "cflinuxfs3-compat")).To(BeTrue())
+		Expect(manifest.StackMatches("bionic-based", "cflinuxfs4")).To(BeFalse())
+
+		Expect(manifest.ForStack("cflinuxfs3-compat").AllDependencyVersions("thing")).To(Equal([]string{"1.0.0", "2.0.0"}))
+	})
+
+	It("resolves default versions for the stack", func() {
+		Expect(manifest.ForStack("cflinuxfs4").DefaultVersion("thing")).To(Equal(libbuildpack.Dependency{Name: "thing", Version: "2.0.0"}))
+
+		_, err := manifest.ForStack("jammy").DefaultVersion("thing")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reports whether the stack is supported", func() {
+		Expect(manifest.ForStack("cflinuxfs4").Supported()).To(BeTrue())
+		Expect(manifest.ForStack("windows").Supported()).To(BeFalse())
+		Expect(manifest.ForStack("jammy").WithOS("linux").Entries()).To(HaveLen(1))
+	})
+
+	It("picks the dependency for the arch and os", func() {
+		dep := libbuildpack.Dependency{Name: "other_thing", Version: "3.1.0"}
+		jammy := manifest.ForStack("jammy").WithOS("linux")
+
+		entry, err := jammy.WithArch("arm64").GetEntry(dep)
+		Expect(err).To(BeNil())
+		Expect(entry.URI).To(Equal("https://example.com/dependencies/other_thing-3.1.0-linux-arm64.tgz"))
+
+		entry, err = jammy.WithArch("amd64").GetEntry(dep)
+		Expect(err).To(BeNil())
+		Expect(entry.URI).To(Equal("https://example.com/dependencies/other_thing-3.1.0-linux-x64.tgz"))
+
+		Expect(jammy.WithArch("s390x").AllDependencyVersions("other_thing")).To(BeEmpty())
+		Expect(jammy.WithArch("").AllDependencyVersions("other_thing")).To(Equal([]string{"3.1.0", "3.1.0"}))
+		Expect(jammy.WithOS("windows").AllDependencyVersions("other_thing")).To(BeEmpty())
+	})
+})
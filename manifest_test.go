@@ -208,6 +208,46 @@ ruby:
 		})
 	})
 
+	Describe("dependency metadata", func() {
+		BeforeEach(func() { manifestDir = "fixtures/manifest/metadata" })
+
+		It("reads licenses, cpe, purl and source", func() {
+			entry, err := manifest.GetEntry(libbuildpack.Dependency{Name: "thing", Version: "1"})
+			Expect(err).To(BeNil())
+			Expect(entry.Licenses).To(Equal([]string{"MIT", "BSD-3-Clause"}))
+			Expect(entry.CPE).To(Equal("cpe:2.3:a:example:thing:1:*:*:*:*:*:*:*"))
+			Expect(entry.PURL).To(Equal("pkg:generic/thing@1"))
+			Expect(entry.Source).To(Equal("https://example.com/sources/thing-1.tar.gz"))
+			Expect(entry.SourceSHA256).To(Equal("646b43b5d718913d6211e2c18b2b3b667cf6eaa76a2493e55b1de5ca04c2578e"))
+		})
+
+		It("lists the licenses for the current stack", func() {
+			Expect(manifest.Licenses()).To(Equal([]string{"Apache-2.0", "BSD-3-Clause", "MIT"}))
+		})
+
+		It("finds dependencies by license", func() {
+			entries := manifest.EntriesWithLicense("MIT")
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].Dependency).To(Equal(libbuildpack.Dependency{Name: "thing", Version: "1"}))
+			Expect(entries[1].Dependency).To(Equal(libbuildpack.Dependency{Name: "other_thing", Version: "2"}))
+
+			Expect(manifest.EntriesWithLicense("GPL-2.0-only")).To(BeEmpty())
+		})
+
+		It("finds dependencies by purl and cpe", func() {
+			entry, err := manifest.GetEntryByPURL("pkg:generic/other_thing@2")
+			Expect(err).To(BeNil())
+			Expect(entry.Dependency).To(Equal(libbuildpack.Dependency{Name: "other_thing", Version: "2"}))
+
+			entry, err = manifest.GetEntryByCPE("cpe:2.3:a:example:thing:1:*:*:*:*:*:*:*")
+			Expect(err).To(BeNil())
+			Expect(entry.Dependency).To(Equal(libbuildpack.Dependency{Name: "thing", Version: "1"}))
+
+			_, err = manifest.GetEntryByPURL("pkg:generic/other_thing@3")
+			Expect(err).To(MatchError("dependency with purl pkg:generic/other_thing@3 not found"))
+		})
+	})
+
 	Describe("AllDependencyVersions", func() {
 		It("returns all the versions of the dependency", func() {
 			versions := manifest.AllDependencyVersions("dotnet-runtime")
@@ -0,0 +1,317 @@
+package libbuildpack
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestProblem is a mistake in a manifest found by ValidateManifest. Line
+// is zero when the position of the mistake is not known.
+type ManifestProblem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (p ManifestProblem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+var (
+	sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	sha512Pattern = regexp.MustCompile(`^[0-9a-f]{128}$`)
+	purlPattern   = regexp.MustCompile(`^pkg:[A-Za-z.+-][A-Za-z0-9.+-]*/[^@?#]+(@[^?#]+)?(\?[^#]*)?(#.*)?$`)
+)
+
+// ValidCPE accepts CPE 2.3 formatted strings and CPE 2.2 URIs
+func ValidCPE(cpe string) bool {
+	if strings.HasPrefix(cpe, "cpe:/") {
+		return len(cpe) > len("cpe:/")
+	}
+	parts := strings.Split(cpe, ":")
+	return len(parts) == 13 && parts[0] == "cpe" && parts[1] == "2.3" && len(parts[2]) == 1 && strings.Contains("aho*", parts[2])
+}
+
+// ValidPURL accepts package URLs such as pkg:generic/node@18.1.0
+func ValidPURL(purl string) bool {
+	return purlPattern.MatchString(purl)
+}
+
+// EntryProblem is a mistake in the manifest key Key of a dependency
+type EntryProblem struct {
+	Key     string
+	Message string
+}
+
+// MetadataProblems lists the mistakes in the SBOM metadata of e: its
+// licenses, cpe, purl and source_sha256
+func (e *ManifestEntry) MetadataProblems() []EntryProblem {
+	var problems []EntryProblem
+	for _, license := range e.Licenses {
+		if strings.TrimSpace(license) == "" {
+			problems = append(problems, EntryProblem{"licenses", "has an empty license"})
+			break
+		}
+	}
+	if e.CPE != "" && !ValidCPE(e.CPE) {
+		problems = append(problems, EntryProblem{"cpe", fmt.Sprintf("has an invalid cpe %s", e.CPE)})
+	}
+	if e.PURL != "" && !ValidPURL(e.PURL) {
+		problems = append(problems, EntryProblem{"purl", fmt.Sprintf("has an invalid purl %s", e.PURL)})
+	}
+	if e.SourceSHA256 != "" {
+		if e.Source == "" {
+			problems = append(problems, EntryProblem{"source_sha256", "has a source_sha256 but no source"})
+		}
+		if !sha256Pattern.MatchString(e.SourceSHA256) {
+			problems = append(problems, EntryProblem{"source_sha256", fmt.Sprintf("has an invalid source_sha256: expected 64 lowercase hex characters, got %d characters", len(e.SourceSHA256))})
+		}
+	}
+	return problems
+}
+
+// ValidateManifest reports every mistake in the manifest file, and the
+// manifests it includes, that would otherwise only be found while staging.
+// Problems are sorted by file and line.
+func ValidateManifest(file string) ([]ManifestProblem, error) {
+	parts, err := readManifestParts(file)
+	if err != nil {
+		return nil, err
+	}
+	stack := parts[0].manifest.Stack
+
+	var entries []ManifestEntry
+	for _, part := range parts {
+		entries = append(entries, part.manifest.ManifestEntries...)
+	}
+
+	type position struct {
+		file string
+		line int
+	}
+	firstSeen := map[string]position{}
+	defaultsSeen := map[string]position{}
+	deprecationsSeen := map[string]position{}
+	mainPath := filepath.Join(filepath.Dir(file), parts[0].file)
+	seenAt := func(first position, current string) string {
+		if first.file == current {
+			return fmt.Sprintf("on line %d", first.line)
+		}
+		return fmt.Sprintf("in %s on line %d", first.file, first.line)
+	}
+
+	var problems []ManifestProblem
+	for partIdx, part := range parts {
+		path := filepath.Join(filepath.Dir(file), part.file)
+		lines := scanManifestLines(part.data)
+		var partProblems []ManifestProblem
+		report := func(line int, format string, args ...interface{}) {
+			partProblems = append(partProblems, ManifestProblem{File: path, Line: line, Message: fmt.Sprintf(format, args...)})
+		}
+
+		for idx, e := range part.manifest.ManifestEntries {
+			item := lines.item("dependencies", idx)
+			name := fmt.Sprintf("dependency %s %s", e.Dependency.Name, e.Dependency.Version)
+
+			if e.Dependency.Name == "" {
+				report(item.line, "dependency has no name")
+			}
+			if e.Dependency.Version == "" {
+				report(item.line, "%s has no version", name)
+			}
+			if e.URI == "" && e.File == "" {
+				report(item.line, "%s has neither a uri nor a file", name)
+			}
+
+			if e.SHA256 == "" && e.SHA512 == "" {
+				report(item.line, "%s has no sha256", name)
+			}
+			if e.SHA256 != "" && !sha256Pattern.MatchString(e.SHA256) {
+				report(item.key("sha256"), "%s has an invalid sha256: expected 64 lowercase hex characters, got %d characters", name, len(e.SHA256))
+			}
+			if e.SHA512 != "" && !sha512Pattern.MatchString(e.SHA512) {
+				report(item.key("sha512"), "%s has an invalid sha512: expected 128 lowercase hex characters, got %d characters", name, len(e.SHA512))
+			}
+			for _, problem := range e.MetadataProblems() {
+				report(item.key(problem.Key), "%s %s", name, problem.Message)
+			}
+			if (e.SignatureURI != "" || e.SignatureFile != "") && e.PublicKey == "" {
+				report(item.line, "%s has a signature but no public_key", name)
+			}
+
+			if len(e.CFStacks) == 0 && stack == "" {
+				report(item.line, "%s has no cf_stacks", name)
+			}
+			for _, s := range e.CFStacks {
+				key := strings.Join([]string{e.Dependency.Name, e.Dependency.Version, s, e.Arch, e.OS}, " ")
+				if first, ok := firstSeen[key]; ok {
+					report(item.line, "%s is defined more than once for stack %s%s (first %s)", name, s, platformSuffix(e), seenAt(first, path))
+				} else {
+					firstSeen[key] = position{path, item.line}
+				}
+			}
+		}
+
+		for idx, d := range part.manifest.DefaultVersions {
+			item := lines.item("default_versions", idx)
+
+			// manifest.yml overrides included defaults, but included files must not conflict
+			if first, ok := defaultsSeen[d.Name]; !ok {
+				defaultsSeen[d.Name] = position{path, item.line}
+			} else if partIdx > 0 && first.file != mainPath {
+				report(item.line, "default version of %s is defined more than once (first %s)", d.Name, seenAt(first, path))
+			}
+
+			stacks := map[string][]string{}
+			for _, e := range entries {
+				if e.Dependency.Name != d.Name {
+					continue
+				}
+				for _, s := range e.CFStacks {
+					stacks[s] = append(stacks[s], e.Dependency.Version)
+				}
+				if len(e.CFStacks) == 0 {
+					stacks[stack] = append(stacks[stack], e.Dependency.Version)
+				}
+			}
+
+			if len(stacks) == 0 {
+				report(item.line, "default version %s %s matches no dependency", d.Name, d.Version)
+				continue
+			}
+			var names []string
+			for s := range stacks {
+				names = append(names, s)
+			}
+			sort.Strings(names)
+			for _, s := range names {
+				if _, err := FindMatchingVersion(d.Version, stacks[s]); err != nil {
+					report(item.key("version"), "default version %s %s matches no dependency for stack %s", d.Name, d.Version, s)
+				}
+			}
+		}
+
+		for idx, d := range part.manifest.Deprecations {
+			item := lines.item("dependency_deprecation_dates", idx)
+
+			key := d.Name + " " + d.VersionLine
+			if first, ok := deprecationsSeen[key]; !ok {
+				deprecationsSeen[key] = position{path, item.line}
+			} else if partIdx > 0 && first.file != mainPath {
+				report(item.line, "deprecation of %s %s is defined more than once (first %s)", d.Name, d.VersionLine, seenAt(first, path))
+			}
+
+			if _, err := time.Parse(dateFormat, d.Date); err != nil {
+				report(item.key("date"), "deprecation date %q of %s %s is not formatted as YYYY-MM-DD", d.Date, d.Name, d.VersionLine)
+			}
+			if d.VersionLine == "" {
+				report(item.line, "deprecation of %s has no version_line", d.Name)
+			}
+		}
+
+		sort.SliceStable(partProblems, func(i, j int) bool { return partProblems[i].Line < partProblems[j].Line })
+		problems = append(problems, partProblems...)
+	}
+
+	return problems, nil
+}
+
+// platformSuffix names the arch and os an entry is limited to, if any
+func platformSuffix(e ManifestEntry) string {
+	var platform []string
+	if e.OS != "" {
+		platform = append(platform, e.OS)
+	}
+	if e.Arch != "" {
+		platform = append(platform, e.Arch)
+	}
+	if len(platform) == 0 {
+		return ""
+	}
+	return " on " + strings.Join(platform, "/")
+}
+
+type manifestItem struct {
+	line int
+	keys map[string]int
+}
+
+// key is the line of key in the item, or of the item itself
+func (i manifestItem) key(key string) int {
+	if line, ok := i.keys[key]; ok {
+		return line
+	}
+	return i.line
+}
+
+type manifestLines map[string][]manifestItem
+
+func (l manifestLines) item(section string, idx int) manifestItem {
+	if items := l[section]; idx < len(items) {
+		return items[idx]
+	}
+	return manifestItem{}
+}
+
+var yamlKeyPattern = regexp.MustCompile(`^([A-Za-z0-9_]+):`)
+
+// scanManifestLines finds the lines of the list items, and their keys, in the
+// top level sections of a manifest. yaml.v2 does not report positions.
+func scanManifestLines(data []byte) manifestLines {
+	lines := manifestLines{}
+
+	var section string
+	itemIndent, keyIndent := -1, -1
+	for idx, text := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(text, " ")
+		indent := len(text) - len(trimmed)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || text == "---" {
+			continue
+		}
+
+		if indent == 0 && !strings.HasPrefix(trimmed, "-") {
+			section, itemIndent, keyIndent = "", -1, -1
+			if match := yamlKeyPattern.FindStringSubmatch(trimmed); match != nil {
+				section = match[1]
+			}
+			continue
+		}
+		if section == "" {
+			continue
+		}
+
+		if (trimmed == "-" || strings.HasPrefix(trimmed, "- ")) && (itemIndent == -1 || indent == itemIndent) {
+			itemIndent = indent
+			lines[section] = append(lines[section], manifestItem{line: idx + 1, keys: map[string]int{}})
+
+			rest := strings.TrimLeft(strings.TrimPrefix(trimmed, "-"), " ")
+			keyIndent = len(text) - len(rest)
+			if rest == "" {
+				keyIndent = -1
+			}
+			trimmed, indent = rest, keyIndent
+		}
+
+		items := lines[section]
+		if len(items) == 0 || indent <= itemIndent {
+			continue
+		}
+		if keyIndent == -1 {
+			keyIndent = indent
+		}
+		if indent == keyIndent {
+			if match := yamlKeyPattern.FindStringSubmatch(trimmed); match != nil {
+				items[len(items)-1].keys[match[1]] = idx + 1
+			}
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,70 @@
+package libbuildpack_test
+
+import (
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ValidateManifest", func() {
+	It("reports every problem with its line", func() {
+		file := filepath.Join("fixtures", "manifest", "invalid", "manifest.yml")
+		problems, err := libbuildpack.ValidateManifest(file)
+		Expect(err).To(BeNil())
+
+		var messages []string
+		for _, problem := range problems {
+			messages = append(messages, problem.String())
+		}
+		Expect(messages).To(Equal([]string{
+			file + ":5: default version thing 1.x matches no dependency for stack cflinuxfs4",
+			file + ":6: default version missing 2.x matches no dependency",
+			file + ":12: dependency thing 1.0.0 has an invalid sha256: expected 64 lowercase hex characters, got 63 characters",
+			file + ":22: dependency thing 2.0.0 is defined more than once for stack cflinuxfs4 (first on line 15)",
+			file + ":31: deprecation date \"01/02/2027\" of thing 1.x is not formatted as YYYY-MM-DD",
+		}))
+	})
+
+	It("accepts a valid manifest", func() {
+		Expect(libbuildpack.ValidateManifest(filepath.Join("fixtures", "manifest", "metadata", "manifest.yml"))).To(BeEmpty())
+	})
+
+	It("fails on unparsable manifests", func() {
+		_, err := libbuildpack.ValidateManifest(filepath.Join("fixtures", "manifest", "missing", "manifest.yml"))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("MetadataProblems", func() {
+	It("lists the mistakes in the SBOM metadata of a dependency by key", func() {
+		entry := libbuildpack.ManifestEntry{
+			Licenses:     []string{"MIT", " "},
+			CPE:          "ruby-lang:ruby",
+			PURL:         "pkg:generic/ruby@3.1.3",
+			SourceSHA256: "abc",
+		}
+		Expect(entry.MetadataProblems()).To(Equal([]libbuildpack.EntryProblem{
+			{Key: "licenses", Message: "has an empty license"},
+			{Key: "cpe", Message: "has an invalid cpe ruby-lang:ruby"},
+			{Key: "source_sha256", Message: "has a source_sha256 but no source"},
+			{Key: "source_sha256", Message: "has an invalid source_sha256: expected 64 lowercase hex characters, got 3 characters"},
+		}))
+	})
+})
+
+var _ = Describe("ValidCPE and ValidPURL", func() {
+	It("accepts well formed identifiers", func() {
+		Expect(libbuildpack.ValidCPE("cpe:2.3:a:nodejs:node.js:18.1.0:*:*:*:*:*:*:*")).To(BeTrue())
+		Expect(libbuildpack.ValidCPE("cpe:/a:nodejs:node.js:18.1.0")).To(BeTrue())
+		Expect(libbuildpack.ValidPURL("pkg:generic/node@18.1.0?arch=x64")).To(BeTrue())
+	})
+
+	It("rejects malformed identifiers", func() {
+		Expect(libbuildpack.ValidCPE("cpe:2.3:a:nodejs")).To(BeFalse())
+		Expect(libbuildpack.ValidCPE("cpe:2.3:x:nodejs:node.js:18.1.0:*:*:*:*:*:*:*")).To(BeFalse())
+		Expect(libbuildpack.ValidPURL("generic/node@18.1.0")).To(BeFalse())
+	})
+})
@@ -0,0 +1,119 @@
+package libbuildpack
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The manifest types remember the mapping they were read from, so that
+// writing them back keeps the order of the keys and the keys they do not know
+// about, e.g. the ones only used by compile-extensions or other tooling.
+
+type manifestYAML Manifest
+type manifestEntryYAML ManifestEntry
+type deprecationDateYAML DeprecationDate
+
+func (m *Manifest) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&m.raw); err != nil {
+		return err
+	}
+	return unmarshal((*manifestYAML)(m))
+}
+
+func (m Manifest) MarshalYAML() (interface{}, error) {
+	return marshalOrdered(manifestYAML(m), m.raw)
+}
+
+func (e *ManifestEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&e.raw); err != nil {
+		return err
+	}
+	return unmarshal((*manifestEntryYAML)(e))
+}
+
+func (e ManifestEntry) MarshalYAML() (interface{}, error) {
+	return marshalOrdered(manifestEntryYAML(e), e.raw)
+}
+
+func (d *DeprecationDate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&d.raw); err != nil {
+		return err
+	}
+	return unmarshal((*deprecationDateYAML)(d))
+}
+
+func (d DeprecationDate) MarshalYAML() (interface{}, error) {
+	return marshalOrdered(deprecationDateYAML(d), d.raw)
+}
+
+// marshalOrdered writes the fields of typed in the order of the keys in raw,
+// followed by fields that were not in raw. Keys of raw that typed does not
+// know are written unchanged; known keys that typed omits are dropped.
+func marshalOrdered(typed interface{}, raw yaml.MapSlice) (yaml.MapSlice, error) {
+	data, err := yaml.Marshal(typed)
+	if err != nil {
+		return nil, err
+	}
+	var fields yaml.MapSlice
+	if err := yaml.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return fields, nil
+	}
+
+	values := map[string]interface{}{}
+	for _, field := range fields {
+		values[fmt.Sprint(field.Key)] = field.Value
+	}
+	known := yamlKeys(reflect.TypeOf(typed))
+
+	out := yaml.MapSlice{}
+	written := map[string]bool{}
+	for _, item := range raw {
+		key := fmt.Sprint(item.Key)
+		if !known[key] {
+			out = append(out, item)
+		} else if value, ok := values[key]; ok {
+			out = append(out, yaml.MapItem{Key: item.Key, Value: value})
+			written[key] = true
+		}
+	}
+	for _, field := range fields {
+		if !written[fmt.Sprint(field.Key)] {
+			out = append(out, field)
+		}
+	}
+	return out, nil
+}
+
+// yamlKeys lists the keys the yaml tags of struct type t map to
+func yamlKeys(t reflect.Type) map[string]bool {
+	keys := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		if len(tag) > 1 && tag[1] == "inline" && field.Type.Kind() == reflect.Struct {
+			for key := range yamlKeys(field.Type) {
+				keys[key] = true
+			}
+			continue
+		}
+		if tag[0] == "-" {
+			continue
+		}
+		if tag[0] == "" {
+			keys[strings.ToLower(field.Name)] = true
+		} else {
+			keys[tag[0]] = true
+		}
+	}
+	return keys
+}
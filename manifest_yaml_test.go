@@ -0,0 +1,81 @@
+package libbuildpack_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	yaml "gopkg.in/yaml.v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Manifest YAML", func() {
+	var (
+		original []byte
+		manifest libbuildpack.Manifest
+	)
+
+	BeforeEach(func() {
+		var err error
+		original, err = ioutil.ReadFile(filepath.Join("fixtures", "manifest", "roundtrip", "manifest.yml"))
+		Expect(err).To(BeNil())
+
+		manifest = libbuildpack.Manifest{}
+		Expect(yaml.Unmarshal(original, &manifest)).To(Succeed())
+	})
+
+	It("reads the fields it knows", func() {
+		Expect(manifest.LanguageString).To(Equal("sample"))
+		Expect(manifest.ManifestEntries).To(HaveLen(1))
+		Expect(manifest.ManifestEntries[0].Name).To(Equal("thing"))
+		Expect(manifest.ManifestEntries[0].Modules).To(Equal([]string{"zlib"}))
+		Expect(manifest.Deprecations[0].Date).To(Equal("2027-01-02"))
+	})
+
+	It("writes back unknown keys in their original order", func() {
+		data, err := yaml.Marshal(manifest)
+		Expect(err).To(BeNil())
+		Expect(string(data)).To(Equal(string(original)))
+	})
+
+	It("writes changes in place and drops omitted keys", func() {
+		manifest.ManifestEntries[0].URI = "https://mirror.example.com/thing-1.tgz"
+		manifest.ManifestEntries[0].CFStacks = nil
+		manifest.ManifestEntries[0].File = "dependencies/thing-1.tgz"
+		manifest.Stack = "cflinuxfs3"
+
+		var written yaml.MapSlice
+		data, err := yaml.Marshal(manifest)
+		Expect(err).To(BeNil())
+		Expect(yaml.Unmarshal(data, &written)).To(Succeed())
+
+		var keys []interface{}
+		for _, item := range written {
+			keys = append(keys, item.Key)
+		}
+		Expect(keys).To(Equal([]interface{}{"language", "url_to_dependency_map", "exclude_files", "dependencies", "default_versions", "dependency_deprecation_dates", "stack"}))
+
+		var entryKeys []interface{}
+		for _, item := range written[3].Value.([]interface{})[0].(yaml.MapSlice) {
+			entryKeys = append(entryKeys, item.Key)
+		}
+		Expect(entryKeys).To(Equal([]interface{}{"name", "version", "md5", "uri", "sha256", "modules", "file"}))
+	})
+
+	It("round trips through YAML.Write", func() {
+		tmpDir, err := ioutil.TempDir("", "manifest-yaml")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(tmpDir)
+
+		m, err := libbuildpack.NewManifest(filepath.Join("fixtures", "manifest", "roundtrip"), nil, time.Now())
+		Expect(err).To(BeNil())
+		Expect(libbuildpack.NewYAML().Write(filepath.Join(tmpDir, "manifest.yml"), m)).To(Succeed())
+		data, err := ioutil.ReadFile(filepath.Join(tmpDir, "manifest.yml"))
+		Expect(err).To(BeNil())
+		Expect(string(data)).To(Equal(string(original)))
+	})
+})
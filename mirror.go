@@ -0,0 +1,87 @@
+package libbuildpack
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// DependencyMirror rewrites the URI of a dependency before it is downloaded,
+// e.g. to reach an internal mirror from a foundation without internet access
+type DependencyMirror struct {
+	// Match is either a host name (example.com), which matches the host on
+	// any port, a host and port (example.com:8443), or a URI prefix
+	// (https://example.com/deps/)
+	Match string `yaml:"match"`
+	// Mirror replaces the scheme and host of a matching host, or the matching prefix
+	Mirror string `yaml:"mirror"`
+}
+
+// DependencyMirrorsEnv holds comma separated match=mirror pairs, which take
+// precedence over the dependency_mirrors of the manifest and override.yml
+const DependencyMirrorsEnv = "BP_DEPENDENCY_MIRRORS"
+
+func (r DependencyMirror) rewrite(uri string) (string, bool) {
+	if r.Match == "" {
+		return "", false
+	}
+
+	if strings.Contains(r.Match, "://") {
+		if !strings.HasPrefix(uri, r.Match) {
+			return "", false
+		}
+		return r.Mirror + strings.TrimPrefix(uri, r.Match), true
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", false
+	}
+	if _, _, err := net.SplitHostPort(r.Match); err == nil {
+		if !strings.EqualFold(u.Host, r.Match) {
+			return "", false
+		}
+	} else if !strings.EqualFold(u.Hostname(), strings.Trim(r.Match, "[]")) {
+		return "", false
+	}
+	rest := u.EscapedPath()
+	if u.RawQuery != "" {
+		rest += "?" + u.RawQuery
+	}
+	return strings.TrimSuffix(r.Mirror, "/") + rest, true
+}
+
+func (m *Manifest) dependencyMirrors() ([]DependencyMirror, error) {
+	var mirrors []DependencyMirror
+
+	for _, pair := range strings.Split(os.Getenv(DependencyMirrorsEnv), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid %s entry %q, expected match=mirror", DependencyMirrorsEnv, pair)
+		}
+		mirrors = append(mirrors, DependencyMirror{Match: parts[0], Mirror: parts[1]})
+	}
+
+	return append(mirrors, m.DependencyMirrors...), nil
+}
+
+// MirroredURI returns uri rewritten by the first matching mirror, or uri itself
+func (m *Manifest) MirroredURI(uri string) (string, error) {
+	mirrors, err := m.dependencyMirrors()
+	if err != nil {
+		return "", err
+	}
+
+	for _, mirror := range mirrors {
+		if mirrored, ok := mirror.rewrite(uri); ok {
+			return mirrored, nil
+		}
+	}
+	return uri, nil
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/cloudfoundry/libbuildpack"
 	"github.com/cloudfoundry/libbuildpack/packager"
@@ -16,19 +17,30 @@ import (
 )
 
 type summaryCmd struct {
+	date string
 }
 
-func (*summaryCmd) Name() string             { return "summary" }
-func (*summaryCmd) Synopsis() string         { return "Print out list of dependencies of this buildpack" }
-func (*summaryCmd) SetFlags(f *flag.FlagSet) {}
+func (*summaryCmd) Name() string     { return "summary" }
+func (*summaryCmd) Synopsis() string { return "Print out list of dependencies of this buildpack" }
+func (s *summaryCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&s.date, "date", "", "list the deprecations after this YYYY-MM-DD date, today by default")
+}
 func (*summaryCmd) Usage() string {
-	return `summary:
+	return `summary [-date <YYYY-MM-DD>]:
   When run in a directory that is structured as a buildpack, prints a list of depedencies of that buildpack.
   (i.e. what would be downloaded to build a cached zipfile)
 `
 }
 func (s *summaryCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	summary, err := packager.Summary(".")
+	now := time.Now()
+	if s.date != "" {
+		var err error
+		if now, err = time.Parse("2006-01-02", s.date); err != nil {
+			log.Printf("error: invalid -date %s, expected YYYY-MM-DD", s.date)
+			return subcommands.ExitUsageError
+		}
+	}
+	summary, err := packager.SummaryAt(".", now)
 	if err != nil {
 		log.Printf("error reading dependencies from manifest: %v", err)
 		return subcommands.ExitFailure
@@ -37,18 +49,162 @@ func (s *summaryCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{
 	return subcommands.ExitSuccess
 }
 
+type lintCmd struct {
+	manifest string
+}
+
+func (*lintCmd) Name() string     { return "lint" }
+func (*lintCmd) Synopsis() string { return "Check manifest.yml for mistakes" }
+func (l *lintCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&l.manifest, "manifest", "manifest.yml", "manifest to check")
+}
+func (*lintCmd) Usage() string {
+	return `lint [-manifest <path to manifest.yml>]:
+  Reports every mistake in the manifest of the buildpack in the current directory and exits non-zero if there are any.
+`
+}
+func (l *lintCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	problems, err := libbuildpack.ValidateManifest(l.manifest)
+	if err != nil {
+		log.Printf("error: %v", err)
+		return subcommands.ExitFailure
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		log.Printf("found %d problems in %s", len(problems), l.manifest)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+type outdatedCmd struct {
+	index string
+}
+
+func (*outdatedCmd) Name() string     { return "outdated" }
+func (*outdatedCmd) Synopsis() string { return "Compare dependencies with a release index" }
+func (o *outdatedCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&o.index, "index", "", "JSON or YAML release index")
+}
+func (*outdatedCmd) Usage() string {
+	return `outdated -index <path to release index>:
+  When run in a directory that is structured as a buildpack, reports the version lines with newer releases,
+  the default versions that should move and the missing deprecation dates, and exits non-zero if there are any.
+  The release index lists the upstream releases of dependencies, e.g.
+
+    releases:
+    - name: ruby
+      versions: [3.2.2, 3.1.4]
+      end_of_life:
+      - version_line: 3.1.x
+        date: 2025-03-31
+
+`
+}
+func (o *outdatedCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if o.index == "" {
+		log.Printf("error: must specify a release index with -index")
+		return subcommands.ExitFailure
+	}
+
+	index, err := packager.ReadReleaseIndex(o.index)
+	if err != nil {
+		log.Printf("error: %v", err)
+		return subcommands.ExitFailure
+	}
+	report, err := packager.Outdated(".", index)
+	if err != nil {
+		log.Printf("error comparing dependencies with %s: %v", o.index, err)
+		return subcommands.ExitFailure
+	}
+
+	if report.Empty() {
+		fmt.Println("All dependencies are up to date")
+		return subcommands.ExitSuccess
+	}
+	fmt.Println(report)
+	return subcommands.ExitFailure
+}
+
+type depCmd struct {
+	manifest string
+	stacks   string
+	edit     packager.DependencyEdit
+}
+
+func (*depCmd) Name() string             { return "dep" }
+func (*depCmd) Synopsis() string         { return "Add, remove or bump a dependency in manifest.yml" }
+func (*depCmd) SetFlags(f *flag.FlagSet) {}
+func (*depCmd) Usage() string {
+	return `dep add|remove|bump [-manifest <path>] -name <name> -version <version> [-uri <uri>] [-file <path>] [-stacks <stacks>] [-default] [-keep <n>]:
+  Edits the dependencies of manifest.yml, keeping its comments.
+  add inserts a dependency in sorted order with the sha256 of the artifact at -uri, or of -file if given.
+  remove removes every entry of a dependency version.
+  bump adds the newest version of a dependency and removes the older versions of its version line beyond -keep,
+  moving a default version pinned to a removed version.
+  -keep prunes each major.minor line to its newest versions, -default makes the version the default.
+
+`
+}
+func (d *depCmd) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("dep", flag.ContinueOnError)
+	fs.StringVar(&d.manifest, "manifest", "manifest.yml", "manifest to edit")
+	fs.StringVar(&d.edit.Name, "name", "", "dependency name")
+	fs.StringVar(&d.edit.Version, "version", "", "dependency version")
+	fs.StringVar(&d.edit.URI, "uri", "", "dependency uri")
+	fs.StringVar(&d.edit.File, "file", "", "local copy of the artifact at -uri")
+	fs.StringVar(&d.stacks, "stacks", "", "comma separated stacks of the dependency")
+	fs.BoolVar(&d.edit.Default, "default", false, "make the version the default version")
+	fs.IntVar(&d.edit.Keep, "keep", 0, "versions to keep per version line, 0 for all, or for bump 1")
+	return fs
+}
+func (d *depCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() == 0 {
+		log.Printf("error: must specify add, remove or bump")
+		return subcommands.ExitUsageError
+	}
+	if err := d.flags().Parse(f.Args()[1:]); err != nil {
+		return subcommands.ExitUsageError
+	}
+	if d.stacks != "" {
+		d.edit.CFStacks = strings.Split(d.stacks, ",")
+	}
+
+	var err error
+	switch action := f.Arg(0); action {
+	case "add":
+		err = packager.AddDependency(d.manifest, d.edit)
+	case "remove":
+		err = packager.RemoveDependency(d.manifest, d.edit.Name, d.edit.Version)
+	case "bump":
+		err = packager.BumpDependency(d.manifest, d.edit)
+	default:
+		log.Printf("error: unknown action %s, must be add, remove or bump", action)
+		return subcommands.ExitUsageError
+	}
+	if err != nil {
+		log.Printf("error: %v", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
 type buildCmd struct {
 	cached   bool
 	anyStack bool
 	version  string
 	cacheDir string
 	stack    string
+	arch     string
 }
 
 func (*buildCmd) Name() string     { return "build" }
 func (*buildCmd) Synopsis() string { return "Create a buildpack zipfile from the current directory" }
 func (*buildCmd) Usage() string {
-	return `build -stack <stack>|-any-stack [-cached] [-version <version>] [-cachedir <path to cachedir>]:
+	return `build -stack <stack>|-any-stack [-arch <arch>] [-cached] [-version <version>] [-cachedir <path to cachedir>]:
   When run in a directory that is structured as a buildpack, creates a zip file.
 
 `
@@ -60,6 +216,7 @@ func (b *buildCmd) SetFlags(f *flag.FlagSet) {
 
 	f.StringVar(&b.stack, "stack", "", "stack to package buildpack for")
 	f.BoolVar(&b.anyStack, "any-stack", false, "package buildpack for any stack")
+	f.StringVar(&b.arch, "arch", "", "architecture to package dependencies for, every architecture by default")
 }
 func (b *buildCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
 	if b.stack == "" && !b.anyStack {
@@ -79,7 +236,7 @@ func (b *buildCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{})
 		b.version = strings.TrimSpace(string(v))
 	}
 
-	zipFile, err := packager.Package(".", b.cacheDir, b.version, b.stack, b.cached)
+	zipFile, err := packager.PackageForArch(".", b.cacheDir, b.version, b.stack, b.arch, b.cached)
 	if err != nil {
 		log.Printf("error while creating zipfile: %v", err)
 		return subcommands.ExitFailure
@@ -200,6 +357,9 @@ func main() {
 	subcommands.Register(subcommands.CommandsCommand(), "")
 	subcommands.Register(&summaryCmd{}, "Custom")
 	subcommands.Register(&buildCmd{}, "Custom")
+	subcommands.Register(&lintCmd{}, "Custom")
+	subcommands.Register(&outdatedCmd{}, "Custom")
+	subcommands.Register(&depCmd{}, "Custom")
 	subcommands.Register(&initCmd{}, "Custom")
 	subcommands.Register(&upgradeCmd{}, "Custom")
 
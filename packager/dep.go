@@ -0,0 +1,222 @@
+package packager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Masterminds/semver"
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// DependencyEdit describes a dependency for AddDependency and BumpDependency
+type DependencyEdit struct {
+	Name, Version, URI string
+	// File is a local copy of the artifact at URI to compute the sha256 of,
+	// instead of downloading it
+	File     string
+	CFStacks []string
+	// Default makes Version the default version of Name
+	Default bool
+	// Keep prunes each version line of Name to its Keep highest versions,
+	// zero keeps all of them. AddDependency never prunes a version that
+	// default_versions pins.
+	Keep int
+}
+
+// AddDependency adds the artifact at edit.URI to manifestFile, in the order
+// of Dependencies, keeping the comments and formatting of the file
+func AddDependency(manifestFile string, edit DependencyEdit) error {
+	f, err := libbuildpack.OpenManifestFile(manifestFile)
+	if err != nil {
+		return err
+	}
+	if err := addDependency(f, edit); err != nil {
+		return err
+	}
+	return f.Save()
+}
+
+// RemoveDependency removes every entry of name version from manifestFile
+func RemoveDependency(manifestFile, name, version string) error {
+	f, err := libbuildpack.OpenManifestFile(manifestFile)
+	if err != nil {
+		return err
+	}
+	if err := f.RemoveDependency(libbuildpack.Dependency{Name: name, Version: version}); err != nil {
+		return err
+	}
+	return f.Save()
+}
+
+// BumpDependency adds edit.Version of a dependency, which has to be the newest
+// of its version line, and removes the versions it replaces: the older
+// versions of its version line beyond edit.Keep, which defaults to one. A
+// default version pinned to a removed version is moved to edit.Version.
+func BumpDependency(manifestFile string, edit DependencyEdit) error {
+	f, err := libbuildpack.OpenManifestFile(manifestFile)
+	if err != nil {
+		return err
+	}
+	if edit.Keep == 0 {
+		edit.Keep = 1
+	}
+
+	v, err := semver.NewVersion(edit.Version)
+	if err != nil {
+		return fmt.Errorf("cannot bump %s to %s, it is not a semantic version", edit.Name, edit.Version)
+	}
+	for _, e := range f.Manifest().ManifestEntries {
+		if other, err := semver.NewVersion(e.Version); e.Name == edit.Name && err == nil && versionLine(other) == versionLine(v) && other.GreaterThan(v) {
+			return fmt.Errorf("cannot bump %s to %s, %s is newer", edit.Name, edit.Version, e.Version)
+		}
+	}
+
+	pinned := pinnedVersions(f, edit.Name)
+	removed, err := addAndPrune(f, edit, versionLine(v), nil)
+	if err != nil {
+		return err
+	}
+	for _, version := range removed {
+		if pinned[version] {
+			edit.Default = true
+		}
+	}
+	if edit.Default {
+		if err := f.SetDefaultVersion(edit.Name, edit.Version); err != nil {
+			return err
+		}
+	}
+	return f.Save()
+}
+
+func addDependency(f *libbuildpack.ManifestFile, edit DependencyEdit) error {
+	if _, err := addAndPrune(f, edit, "", pinnedVersions(f, edit.Name)); err != nil {
+		return err
+	}
+	if edit.Default {
+		return f.SetDefaultVersion(edit.Name, edit.Version)
+	}
+	return nil
+}
+
+// pinnedVersions are the versions of name that default_versions names exactly
+func pinnedVersions(f *libbuildpack.ManifestFile, name string) map[string]bool {
+	pinned := map[string]bool{}
+	for _, d := range f.Manifest().DefaultVersions {
+		if d.Name == name {
+			pinned[d.Version] = true
+		}
+	}
+	return pinned
+}
+
+// addAndPrune adds edit and prunes version line line of it, or every line if
+// line is empty, except for the protected versions
+func addAndPrune(f *libbuildpack.ManifestFile, edit DependencyEdit, line string, protected map[string]bool) ([]string, error) {
+	if edit.Name == "" || edit.Version == "" || edit.URI == "" {
+		return nil, fmt.Errorf("a dependency needs a name, version and uri")
+	}
+	if len(edit.CFStacks) == 0 {
+		return nil, fmt.Errorf("dependency %s %s needs at least one stack", edit.Name, edit.Version)
+	}
+
+	sum, err := artifactSHA256(edit.URI, edit.File)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute the sha256 of %s %s: %v", edit.Name, edit.Version, err)
+	}
+
+	entry := libbuildpack.ManifestEntry{
+		Dependency: libbuildpack.Dependency{Name: edit.Name, Version: edit.Version},
+		URI:        edit.URI,
+		SHA256:     sum,
+		CFStacks:   edit.CFStacks,
+	}
+	less := func(a, b libbuildpack.ManifestEntry) bool {
+		return lessDependency(a.Name, a.Version, b.Name, b.Version)
+	}
+	if err := f.AddDependency(entry, less); err != nil {
+		return nil, err
+	}
+
+	if edit.Keep == 0 {
+		return nil, nil
+	}
+	return pruneVersions(f, edit.Name, edit.Keep, line, protected)
+}
+
+// pruneVersions keeps the keep highest versions of version line line of name,
+// or of every line if line is empty, and the protected versions. The comments
+// of a removed version move to the highest version of its line.
+func pruneVersions(f *libbuildpack.ManifestFile, name string, keep int, line string, protected map[string]bool) ([]string, error) {
+	var versions []*semver.Version
+	seen := map[string]bool{}
+	for _, e := range f.Manifest().ManifestEntries {
+		if v, err := semver.NewVersion(e.Version); e.Name == name && err == nil && !seen[e.Version] {
+			seen[e.Version] = true
+			versions = append(versions, v)
+		}
+	}
+	sort.Sort(sort.Reverse(semver.Collection(versions)))
+
+	var removed []string
+	kept := map[string]int{}
+	highest := map[string]string{}
+	for _, v := range versions {
+		l := versionLine(v)
+		if line != "" && l != line {
+			continue
+		}
+		if _, ok := highest[l]; !ok {
+			highest[l] = v.Original()
+		}
+		if kept[l] < keep {
+			kept[l]++
+			continue
+		}
+		if protected[v.Original()] {
+			continue
+		}
+
+		dep := libbuildpack.Dependency{Name: name, Version: v.Original()}
+		if err := f.ReplaceDependency(dep, libbuildpack.Dependency{Name: name, Version: highest[l]}); err != nil {
+			return nil, err
+		}
+		removed = append(removed, v.Original())
+	}
+	return removed, nil
+}
+
+// artifactSHA256 is the sha256 of file, or else of the artifact downloaded
+// from uri
+func artifactSHA256(uri, file string) (string, error) {
+	if file == "" {
+		dir, err := ioutil.TempDir("", "dependency")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(dir)
+
+		file = filepath.Join(dir, filepath.Base(uri))
+		if err := downloadFromURI(uri, file); err != nil {
+			return "", err
+		}
+	}
+
+	fh, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fh); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
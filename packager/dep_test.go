@@ -0,0 +1,130 @@
+package packager_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/packager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dependency edits", func() {
+	const artifactSHA256 = "2b8ce60a6b45d9e5337246f5f7907d213f089149978730e644cf14b5e076f7e2"
+
+	var (
+		tmpDir       string
+		manifestFile string
+		artifact     string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "dep")
+		Expect(err).To(BeNil())
+
+		manifestFile = filepath.Join(tmpDir, "manifest.yml")
+		Expect(libbuildpack.CopyFile(filepath.Join("fixtures", "dep", "manifest.yml"), manifestFile)).To(Succeed())
+
+		artifact, err = filepath.Abs(filepath.Join("fixtures", "dep", "ruby-3.1.4.tgz"))
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	readManifest := func() (*libbuildpack.Manifest, string) {
+		manifest, err := libbuildpack.ReadManifest(tmpDir)
+		Expect(err).To(BeNil())
+		data, err := ioutil.ReadFile(manifestFile)
+		Expect(err).To(BeNil())
+		return manifest, string(data)
+	}
+
+	It("adds a dependency with the sha256 of an artifact it downloads", func() {
+		Expect(packager.AddDependency(manifestFile, packager.DependencyEdit{
+			Name: "ruby", Version: "3.1.4", URI: "file://" + artifact, CFStacks: []string{"cflinuxfs4"},
+		})).To(Succeed())
+
+		manifest, data := readManifest()
+		Expect(manifest.ManifestEntries).To(HaveLen(4))
+		Expect(manifest.ManifestEntries[2].Version).To(Equal("3.1.4"))
+		Expect(manifest.ManifestEntries[2].SHA256).To(Equal(artifactSHA256))
+		Expect(data).To(ContainSubstring("# bundler is installed with every ruby\n"))
+		Expect(data).To(ContainSubstring("# the newest ruby\n- name: ruby\n  version: 3.2.2\n"))
+	})
+
+	It("hashes a local copy of the artifact, makes it the default and prunes its version line", func() {
+		Expect(packager.AddDependency(manifestFile, packager.DependencyEdit{
+			Name: "ruby", Version: "3.1.4", URI: "https://example.com/ruby-3.1.4.tgz", File: artifact,
+			CFStacks: []string{"cflinuxfs4"}, Default: true, Keep: 1,
+		})).To(Succeed())
+
+		manifest, data := readManifest()
+		Expect(manifest.ForStack("cflinuxfs4").AllDependencyVersions("ruby")).To(ConsistOf("3.1.4", "3.2.2"))
+		Expect(manifest.ManifestEntries[1].SHA256).To(Equal(artifactSHA256))
+		Expect(manifest.DefaultVersions[0]).To(Equal(libbuildpack.Dependency{Name: "ruby", Version: "3.1.4"}))
+		Expect(data).To(ContainSubstring("  version: 3.1.4 # see dependency_deprecation_dates\n"))
+	})
+
+	It("bumps a dependency, moving a default version pinned to the version it replaces", func() {
+		Expect(packager.BumpDependency(manifestFile, packager.DependencyEdit{
+			Name: "bundler", Version: "2.4.12", URI: "https://example.com/bundler-2.4.12.tgz", File: artifact,
+			CFStacks: []string{"cflinuxfs4"},
+		})).To(Succeed())
+
+		manifest, data := readManifest()
+		Expect(manifest.ManifestEntries[0].Dependency).To(Equal(libbuildpack.Dependency{Name: "bundler", Version: "2.4.12"}))
+		Expect(manifest.ManifestEntries).To(HaveLen(3))
+		Expect(manifest.DefaultVersions).To(ContainElement(libbuildpack.Dependency{Name: "bundler", Version: "2.4.12"}))
+		Expect(manifest.DefaultVersions).To(ContainElement(libbuildpack.Dependency{Name: "ruby", Version: "3.1.x"}))
+		Expect(data).To(ContainSubstring("dependencies:\n# bundler is installed with every ruby\n- name: bundler\n  version: 2.4.12\n"))
+		Expect(data).To(ContainSubstring("# end of the dependencies\n"))
+	})
+
+	It("only prunes the version line of the bumped version", func() {
+		Expect(packager.BumpDependency(manifestFile, packager.DependencyEdit{
+			Name: "ruby", Version: "3.2.3", URI: "https://example.com/ruby-3.2.3.tgz", File: artifact,
+			CFStacks: []string{"cflinuxfs4"},
+		})).To(Succeed())
+
+		manifest, data := readManifest()
+		Expect(manifest.ForStack("cflinuxfs4").AllDependencyVersions("ruby")).To(Equal([]string{"3.1.3", "3.2.3"}))
+		Expect(data).To(ContainSubstring("# the newest ruby\n- name: ruby\n  version: 3.2.3\n"))
+	})
+
+	It("refuses to bump to a version older than one of its version line", func() {
+		before, err := ioutil.ReadFile(manifestFile)
+		Expect(err).To(BeNil())
+
+		Expect(packager.BumpDependency(manifestFile, packager.DependencyEdit{
+			Name: "ruby", Version: "3.1.1", URI: "https://example.com/ruby-3.1.1.tgz", File: artifact,
+			CFStacks: []string{"cflinuxfs4"},
+		})).To(MatchError("cannot bump ruby to 3.1.1, 3.1.3 is newer"))
+
+		Expect(ioutil.ReadFile(manifestFile)).To(Equal(before))
+	})
+
+	It("does not prune a version that default_versions pins", func() {
+		Expect(packager.AddDependency(manifestFile, packager.DependencyEdit{
+			Name: "bundler", Version: "2.4.12", URI: "https://example.com/bundler-2.4.12.tgz", File: artifact,
+			CFStacks: []string{"cflinuxfs4"}, Keep: 1,
+		})).To(Succeed())
+
+		manifest, _ := readManifest()
+		Expect(manifest.ForStack("cflinuxfs4").AllDependencyVersions("bundler")).To(Equal([]string{"2.4.10", "2.4.12"}))
+		Expect(manifest.DefaultVersions).To(ContainElement(libbuildpack.Dependency{Name: "bundler", Version: "2.4.10"}))
+	})
+
+	It("removes a dependency", func() {
+		Expect(packager.RemoveDependency(manifestFile, "ruby", "3.1.3")).To(Succeed())
+
+		manifest, _ := readManifest()
+		Expect(manifest.ForStack("cflinuxfs4").AllDependencyVersions("ruby")).To(Equal([]string{"3.2.2"}))
+
+		Expect(packager.RemoveDependency(manifestFile, "ruby", "3.1.3")).To(MatchError(ContainSubstring("dependency ruby 3.1.3 is not in")))
+	})
+})
@@ -1,7 +1,16 @@
 package packager
 
-import "github.com/Masterminds/semver"
+import (
+	"github.com/Masterminds/semver"
+	"github.com/cloudfoundry/libbuildpack"
+)
 
+// Dependency is a dependency of manifest.yml as the packager used to read it.
+//
+// Deprecated: the packager reads and writes manifests with
+// libbuildpack.ManifestEntry, which keeps the keys it does not know about and
+// has the fields added since, such as sha512, licenses and signatures.
+// Dependency will be removed in a future release.
 type Dependency struct {
 	URI     string   `yaml:"uri"`
 	File    string   `yaml:"file"`
@@ -14,6 +23,10 @@ type Dependency struct {
 
 type Dependencies []Dependency
 
+// Manifest is manifest.yml as the packager used to read it.
+//
+// Deprecated: use libbuildpack.Manifest, see Dependency. Manifest will be
+// removed in a future release.
 type Manifest struct {
 	Language     string       `yaml:"language"`
 	Stack        string       `yaml:"stack"`
@@ -33,41 +46,37 @@ type File struct {
 func (d Dependencies) Len() int      { return len(d) }
 func (d Dependencies) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
 func (d Dependencies) Less(i, j int) bool {
-	if d[i].Name < d[j].Name {
+	return lessDependency(d[i].Name, d[i].Version, d[j].Name, d[j].Version)
+}
+
+// manifestEntries sorts like Dependencies
+type manifestEntries []libbuildpack.ManifestEntry
+
+func (d manifestEntries) Len() int      { return len(d) }
+func (d manifestEntries) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d manifestEntries) Less(i, j int) bool {
+	return lessDependency(d[i].Name, d[i].Version, d[j].Name, d[j].Version)
+}
+
+func lessDependency(name1, version1, name2, version2 string) bool {
+	if name1 < name2 {
 		return true
-	} else if d[i].Name == d[j].Name {
-		v1, e1 := semver.NewVersion(d[i].Version)
-		v2, e2 := semver.NewVersion(d[j].Version)
+	} else if name1 == name2 {
+		v1, e1 := semver.NewVersion(version1)
+		v2, e2 := semver.NewVersion(version2)
 		if e1 == nil && e2 == nil {
 			return v1.LessThan(v2)
 		} else {
-			return d[i].Version < d[j].Version
+			return version1 < version2
 		}
 	}
 	return false
 }
 
-func (m *Manifest) hasStack(stack string) bool {
-	for _, e := range m.Dependencies {
-		for _, s := range e.Stacks {
-			if s == stack {
-				return true
-			}
-		}
-	}
-	return false
+func hasStack(m *libbuildpack.Manifest, stack, arch string) bool {
+	return len(m.ForStack(stack).WithArch(arch).WithOS("").Entries()) > 0
 }
 
-func (m *Manifest) versionsOfDependencyWithStack(depName, stack string) []string {
-	versions := []string{}
-	for _, e := range m.Dependencies {
-		if e.Name == depName {
-			for _, s := range e.Stacks {
-				if s == stack {
-					versions = append(versions, e.Version)
-				}
-			}
-		}
-	}
-	return versions
+func versionsOfDependencyWithStack(m *libbuildpack.Manifest, depName, stack, arch string) []string {
+	return m.ForStack(stack).WithArch(arch).WithOS("").AllDependencyVersions(depName)
 }
@@ -1,6 +1,7 @@
 package packager_test
 
 import (
+	"github.com/cloudfoundry/libbuildpack"
 	"github.com/cloudfoundry/libbuildpack/packager"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -32,4 +33,17 @@ var _ = Describe("Packager", func() {
 			}))
 		})
 	})
+
+	Describe("Manifest", func() {
+		It("still reads manifest.yml with the deprecated field names", func() {
+			var m packager.Manifest
+			Expect(libbuildpack.NewYAML().Load("fixtures/good/manifest.yml", &m)).To(Succeed())
+
+			Expect(m.Language).To(Equal("ruby"))
+			Expect(m.Defaults).To(HaveLen(1))
+			Expect(m.Defaults[0].Version).To(Equal("1.2.3"))
+			Expect(m.Dependencies).To(HaveLen(2))
+			Expect(m.Dependencies[1].Stacks).To(Equal([]string{"cflinuxfs3"}))
+		})
+	})
 })
@@ -0,0 +1,206 @@
+package packager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/Masterminds/semver"
+	"github.com/cloudfoundry/libbuildpack"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ReleaseIndex lists the upstream releases of dependencies, as read from a
+// JSON or YAML file by ReadReleaseIndex
+type ReleaseIndex struct {
+	Releases []Release `yaml:"releases"`
+}
+
+type Release struct {
+	Name      string                         `yaml:"name"`
+	Versions  []string                       `yaml:"versions"`
+	EndOfLife []libbuildpack.DeprecationDate `yaml:"end_of_life"`
+}
+
+// ReadReleaseIndex reads a release index from file, which may be JSON or YAML
+func ReadReleaseIndex(file string) (*ReleaseIndex, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var index ReleaseIndex
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("could not parse release index %s: %v", file, err)
+	}
+	for idx := range index.Releases {
+		for line := range index.Releases[idx].EndOfLife {
+			index.Releases[idx].EndOfLife[line].Name = index.Releases[idx].Name
+		}
+	}
+	return &index, nil
+}
+
+// OutdatedEntry is a version line of a dependency with a newer upstream
+// release than the newest version in the manifest
+type OutdatedEntry struct {
+	Name, VersionLine, Version, Latest string
+}
+
+// OutdatedDefault is a default version that does not select the newest
+// upstream release
+type OutdatedDefault struct {
+	Name, Version, Latest, Suggested string
+}
+
+type OutdatedReport struct {
+	Entries             []OutdatedEntry
+	Defaults            []OutdatedDefault
+	MissingDeprecations []libbuildpack.DeprecationDate
+}
+
+func (r *OutdatedReport) Empty() bool {
+	return len(r.Entries) == 0 && len(r.Defaults) == 0 && len(r.MissingDeprecations) == 0
+}
+
+func (r *OutdatedReport) String() string {
+	var out string
+
+	if len(r.Entries) > 0 {
+		out += "\nOutdated dependencies:\n\n"
+		out += "| name | version line | version | latest |\n|-|-|-|-|\n"
+		for _, e := range r.Entries {
+			out += fmt.Sprintf("| %s | %s | %s | %s |\n", e.Name, e.VersionLine, e.Version, e.Latest)
+		}
+	}
+
+	if len(r.Defaults) > 0 {
+		out += "\nOutdated default versions:\n\n"
+		out += "| name | version | latest | suggested |\n|-|-|-|-|\n"
+		for _, d := range r.Defaults {
+			out += fmt.Sprintf("| %s | %s | %s | %s |\n", d.Name, d.Version, d.Latest, d.Suggested)
+		}
+	}
+
+	if len(r.MissingDeprecations) > 0 {
+		out += "\nMissing deprecation dates:\n\n"
+		out += "| name | version line | date |\n|-|-|-|\n"
+		for _, d := range r.MissingDeprecations {
+			out += fmt.Sprintf("| %s | %s | %s |\n", d.Name, d.VersionLine, d.Date)
+		}
+	}
+
+	return out
+}
+
+// Outdated compares the manifest of bpDir with the release index. Version
+// lines are major.minor.x; versions that are not semantic are ignored.
+func Outdated(bpDir string, index *ReleaseIndex) (*OutdatedReport, error) {
+	manifest, err := libbuildpack.ReadManifest(bpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &OutdatedReport{}
+	for _, release := range index.Releases {
+		// prereleases are not offered as updates
+		upstream := semverVersions(release.Versions)
+		if len(upstream) == 0 {
+			continue
+		}
+
+		var packaged []*semver.Version
+		for _, e := range manifest.ManifestEntries {
+			if v, err := semver.NewVersion(e.Version); e.Name == release.Name && err == nil {
+				packaged = append(packaged, v)
+			}
+		}
+		sort.Sort(semver.Collection(packaged))
+
+		newest := map[string]*semver.Version{}
+		var lines []string
+		for _, v := range packaged {
+			line := versionLine(v)
+			if _, ok := newest[line]; !ok {
+				lines = append(lines, line)
+			}
+			newest[line] = v
+		}
+		for _, line := range lines {
+			latest := latestInLine(upstream, line)
+			if latest != nil && latest.GreaterThan(newest[line]) {
+				report.Entries = append(report.Entries, OutdatedEntry{
+					Name: release.Name, VersionLine: line, Version: newest[line].Original(), Latest: latest.Original(),
+				})
+			}
+		}
+
+		latest := upstream[len(upstream)-1]
+		for _, d := range manifest.DefaultVersions {
+			if d.Name != release.Name {
+				continue
+			}
+			if matched, err := libbuildpack.FindMatchingVersion(d.Version, originals(upstream)); err == nil && matched == latest.Original() {
+				continue
+			}
+			suggested := versionLine(latest)
+			if _, err := semver.NewVersion(d.Version); err == nil {
+				suggested = latest.Original()
+			}
+			report.Defaults = append(report.Defaults, OutdatedDefault{
+				Name: d.Name, Version: d.Version, Latest: latest.Original(), Suggested: suggested,
+			})
+		}
+
+		for _, eol := range release.EndOfLife {
+			constraint, err := semver.NewConstraint(eol.VersionLine)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version line %s of %s in release index: %v", eol.VersionLine, release.Name, err)
+			}
+			for _, v := range packaged {
+				if !constraint.Check(v) {
+					continue
+				}
+				if len(manifest.DeprecationsOf(libbuildpack.Dependency{Name: release.Name, Version: v.Original()})) == 0 {
+					report.MissingDeprecations = append(report.MissingDeprecations, eol)
+				}
+				break
+			}
+		}
+	}
+
+	return report, nil
+}
+
+func semverVersions(versions []string) []*semver.Version {
+	var parsed []*semver.Version
+	for _, version := range versions {
+		if v, err := semver.NewVersion(version); err == nil && v.Prerelease() == "" {
+			parsed = append(parsed, v)
+		}
+	}
+	sort.Sort(semver.Collection(parsed))
+	return parsed
+}
+
+func originals(versions []*semver.Version) []string {
+	var originals []string
+	for _, v := range versions {
+		originals = append(originals, v.Original())
+	}
+	return originals
+}
+
+func versionLine(v *semver.Version) string {
+	return fmt.Sprintf("%d.%d.x", v.Major(), v.Minor())
+}
+
+func latestInLine(versions []*semver.Version, line string) *semver.Version {
+	var latest *semver.Version
+	for _, v := range versions {
+		if versionLine(v) == line {
+			latest = v
+		}
+	}
+	return latest
+}
@@ -0,0 +1,75 @@
+package packager_test
+
+import (
+	"github.com/cloudfoundry/libbuildpack/packager"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Outdated", func() {
+	const buildpackDir = "./fixtures/outdated"
+
+	It("reports version lines with newer releases and missing deprecation dates", func() {
+		index, err := packager.ReadReleaseIndex("./fixtures/outdated/index.json")
+		Expect(err).NotTo(HaveOccurred())
+
+		report, err := packager.Outdated(buildpackDir, index)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Empty()).To(BeFalse())
+
+		Expect(report.Entries).To(Equal([]packager.OutdatedEntry{
+			{Name: "ruby", VersionLine: "3.1.x", Version: "3.1.3", Latest: "3.1.4"},
+		}))
+		Expect(report.Defaults).To(Equal([]packager.OutdatedDefault{
+			{Name: "ruby", Version: "3.1.x", Latest: "3.2.2", Suggested: "3.2.x"},
+		}))
+		Expect(report.MissingDeprecations).To(HaveLen(1))
+		Expect(report.MissingDeprecations[0].Name).To(Equal("ruby"))
+		Expect(report.MissingDeprecations[0].VersionLine).To(Equal("3.1.x"))
+
+		Expect(report.String()).To(Equal(`
+Outdated dependencies:
+
+| name | version line | version | latest |
+|-|-|-|-|
+| ruby | 3.1.x | 3.1.3 | 3.1.4 |
+
+Outdated default versions:
+
+| name | version | latest | suggested |
+|-|-|-|-|
+| ruby | 3.1.x | 3.2.2 | 3.2.x |
+
+Missing deprecation dates:
+
+| name | version line | date |
+|-|-|-|
+| ruby | 3.1.x | 2025-03-31 |
+`))
+	})
+
+	It("reads YAML release indexes and suggests exact default versions", func() {
+		index, err := packager.ReadReleaseIndex("./fixtures/outdated/index.yml")
+		Expect(err).NotTo(HaveOccurred())
+
+		report, err := packager.Outdated(buildpackDir, index)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.Entries).To(Equal([]packager.OutdatedEntry{
+			{Name: "bundler", VersionLine: "2.4.x", Version: "2.4.10", Latest: "2.4.12"},
+		}))
+		Expect(report.Defaults).To(Equal([]packager.OutdatedDefault{
+			{Name: "ruby", Version: "3.1.x", Latest: "3.2.2", Suggested: "3.2.x"},
+			{Name: "bundler", Version: "2.4.10", Latest: "2.4.12", Suggested: "2.4.12"},
+		}))
+		Expect(report.MissingDeprecations).To(BeEmpty())
+	})
+
+	It("is empty when the manifest is up to date", func() {
+		report, err := packager.Outdated(buildpackDir, &packager.ReleaseIndex{Releases: []packager.Release{
+			{Name: "bundler", Versions: []string{"2.4.10"}},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Empty()).To(BeTrue())
+	})
+})
@@ -6,12 +6,12 @@ import (
 	"archive/zip"
 	"crypto/md5"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
@@ -79,8 +79,8 @@ func CompileExtensionPackage(bpDir, version string, cached bool, stack string) (
 	return filepath.Join(dir, zipFile), nil
 }
 
-func validateStack(stack, bpDir string) error {
-	manifest, err := readManifest(bpDir)
+func validateStack(stack, arch, bpDir string) error {
+	manifest, err := libbuildpack.ReadManifest(bpDir)
 	if err != nil {
 		return err
 	}
@@ -93,12 +93,12 @@ func validateStack(stack, bpDir string) error {
 		return nil
 	}
 
-	if len(manifest.Dependencies) > 0 && !manifest.hasStack(stack) {
+	if len(manifest.ManifestEntries) > 0 && !hasStack(manifest, stack, "") {
 		return fmt.Errorf("Stack `%s` not found in manifest", stack)
 	}
 
-	for _, d := range manifest.Defaults {
-		if _, err := libbuildpack.FindMatchingVersion(d.Version, manifest.versionsOfDependencyWithStack(d.Name, stack)); err != nil {
+	for _, d := range manifest.DefaultVersions {
+		if _, err := libbuildpack.FindMatchingVersion(d.Version, versionsOfDependencyWithStack(manifest, d.Name, stack, arch)); err != nil {
 			return fmt.Errorf("No matching default dependency `%s` for stack `%s`", d.Name, stack)
 		}
 	}
@@ -106,16 +106,24 @@ func validateStack(stack, bpDir string) error {
 	return nil
 }
 
-func updateDependencyMap(dependencyMap interface{}, file File) error {
-	dep, ok := dependencyMap.(map[interface{}]interface{})
-	if !ok {
-		return fmt.Errorf("Could not cast deps[idx] to map[interface{}]interface{}")
+// validateDependencyMetadata fails on the first mistake in the SBOM metadata
+// of a dependency, see libbuildpack.ManifestEntry.MetadataProblems
+func validateDependencyMetadata(bpDir string) error {
+	manifest, err := libbuildpack.ReadManifest(bpDir)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range manifest.ManifestEntries {
+		if problems := d.MetadataProblems(); len(problems) > 0 {
+			return fmt.Errorf("Dependency `%s` `%s` %s", d.Name, d.Version, problems[0].Message)
+		}
 	}
-	dep["file"] = file.Name
+
 	return nil
 }
 
-func downloadDependency(dependency Dependency, cacheDir string) (File, error) {
+func downloadDependency(dependency libbuildpack.ManifestEntry, cacheDir string) (File, error) {
 	file := filepath.Join("dependencies", fmt.Sprintf("%x", md5.Sum([]byte(dependency.URI))), filepath.Base(dependency.URI))
 	if err := os.MkdirAll(cacheDir, 0755); err != nil {
 		log.Fatalf("error: %v", err)
@@ -127,19 +135,59 @@ func downloadDependency(dependency Dependency, cacheDir string) (File, error) {
 		}
 	}
 
-	if err := checkSha256(filepath.Join(cacheDir, file), dependency.SHA256); err != nil {
+	if err := checkDigests(filepath.Join(cacheDir, file), dependency); err != nil {
 		return File{}, err
 	}
 
 	return File{file, filepath.Join(cacheDir, file)}, nil
 }
 
+// downloadSignature fetches the signature of a downloaded dependency and
+// verifies it against the public key in bpDir, so it can be cached alongside
+func downloadSignature(dependency libbuildpack.ManifestEntry, file File, cacheDir, bpDir string) (File, error) {
+	if dependency.PublicKey == "" {
+		return File{}, fmt.Errorf("dependency %s %s has a signature_uri but no public_key", dependency.Name, dependency.Version)
+	}
+	publicKey, err := ioutil.ReadFile(filepath.Join(bpDir, dependency.PublicKey))
+	if err != nil {
+		return File{}, err
+	}
+
+	sigFile := filepath.Join("dependencies", fmt.Sprintf("%x", md5.Sum([]byte(dependency.SignatureURI))), filepath.Base(dependency.SignatureURI))
+	if _, err := os.Stat(filepath.Join(cacheDir, sigFile)); err != nil {
+		if err := downloadFromURI(dependency.SignatureURI, filepath.Join(cacheDir, sigFile)); err != nil {
+			return File{}, err
+		}
+	}
+
+	signature, err := ioutil.ReadFile(filepath.Join(cacheDir, sigFile))
+	if err != nil {
+		return File{}, err
+	}
+	if err := libbuildpack.VerifySignature(file.Path, signature, publicKey); err != nil {
+		return File{}, fmt.Errorf("could not verify the signature of %s %s: %v", dependency.Name, dependency.Version, err)
+	}
+
+	return File{sigFile, filepath.Join(cacheDir, sigFile)}, nil
+}
+
+// Package packages the dependencies for every arch, see PackageForArch
 func Package(bpDir, cacheDir, version, stack string, cached bool) (string, error) {
+	return PackageForArch(bpDir, cacheDir, version, stack, "", cached)
+}
+
+// PackageForArch packages the dependencies for arch, and those not limited
+// to an arch. An empty arch packages the dependencies for every arch.
+func PackageForArch(bpDir, cacheDir, version, stack, arch string, cached bool) (string, error) {
 	bpDir, err := filepath.Abs(bpDir)
 	if err != nil {
 		return "", err
 	}
-	err = validateStack(stack, bpDir)
+	err = validateStack(stack, arch, bpDir)
+	if err != nil {
+		return "", err
+	}
+	err = validateDependencyMetadata(bpDir)
 	if err != nil {
 		return "", err
 	}
@@ -153,7 +201,7 @@ func Package(bpDir, cacheDir, version, stack string, cached bool) (string, error
 		return "", err
 	}
 
-	manifest, err := readManifest(dir)
+	manifest, err := libbuildpack.ReadManifest(dir)
 	if err != nil {
 		return "", err
 	}
@@ -168,48 +216,71 @@ func Package(bpDir, cacheDir, version, stack string, cached bool) (string, error
 		}
 	}
 
+	// included manifests are flattened into manifest.yml, so shipping them
+	// would merge them a second time at staging
+	included, err := libbuildpack.IncludedManifests(dir)
+	if err != nil {
+		return "", err
+	}
+	flattened := map[string]bool{}
+	for _, name := range included {
+		flattened[filepath.Clean(name)] = true
+	}
+
 	files := []File{}
 	for _, name := range manifest.IncludeFiles {
+		if flattened[filepath.Clean(name)] {
+			continue
+		}
 		files = append(files, File{name, filepath.Join(dir, name)})
 	}
 
-	var m map[string]interface{}
-	if err := libbuildpack.NewYAML().Load(filepath.Join(dir, "manifest.yml"), &m); err != nil {
-		return "", err
-	}
-
 	if stack != "" {
-		m["stack"] = stack
+		manifest.Stack = stack
 	}
 
-	deps, ok := m["dependencies"].([]interface{})
-	if !ok {
-		return "", fmt.Errorf("Could not cast dependencies to []interface{}")
-	}
-	dependenciesForStack := []interface{}{}
-	for idx, d := range manifest.Dependencies {
-		for _, s := range d.Stacks {
-			if stack == "" || s == stack {
-				dependencyMap := deps[idx]
+	dependenciesForStack := []libbuildpack.ManifestEntry{}
+	for _, d := range manifest.ManifestEntries {
+		if !d.SupportsPlatform("", arch) {
+			continue
+		}
+		for _, s := range d.CFStacks {
+			if stack == "" || manifest.StackMatches(s, stack) {
 				if cached {
 					if file, err := downloadDependency(d, cacheDir); err != nil {
 						return "", err
 					} else {
-						updateDependencyMap(dependencyMap, file)
+						d.File = file.Name
 						files = append(files, file)
+
+						if d.SignatureURI != "" {
+							sigFile, err := downloadSignature(d, file, cacheDir, dir)
+							if err != nil {
+								return "", err
+							}
+							d.SignatureFile = sigFile.Name
+							files = append(files, sigFile)
+						}
 					}
 				}
 				if stack != "" {
-					delete(dependencyMap.(map[interface{}]interface{}), "cf_stacks")
+					d.CFStacks = nil
 				}
-				dependenciesForStack = append(dependenciesForStack, dependencyMap)
+				dependenciesForStack = append(dependenciesForStack, d)
 				break
 			}
 		}
 	}
-	m["dependencies"] = dependenciesForStack
 
-	if err := libbuildpack.NewYAML().Write(filepath.Join(dir, "manifest.yml"), m); err != nil {
+	// the installer needs the public keys to verify signatures at staging time
+	for _, d := range manifest.ManifestEntries {
+		if d.PublicKey != "" && !containsFile(files, d.PublicKey) {
+			files = append(files, File{d.PublicKey, filepath.Join(dir, d.PublicKey)})
+		}
+	}
+	manifest.ManifestEntries = dependenciesForStack
+
+	if err := libbuildpack.NewYAML().Write(filepath.Join(dir, "manifest.yml"), manifest); err != nil {
 		return "", err
 	}
 
@@ -223,7 +294,7 @@ func Package(bpDir, cacheDir, version, stack string, cached bool) (string, error
 		cachedPart = "-cached"
 	}
 
-	fileName := fmt.Sprintf("%s_buildpack%s%s-v%s.zip", manifest.Language, cachedPart, stackPart, version)
+	fileName := fmt.Sprintf("%s_buildpack%s%s-v%s.zip", manifest.Language(), cachedPart, stackPart, version)
 	zipFile := filepath.Join(bpDir, fileName)
 
 	if err := ZipFiles(zipFile, files); err != nil {
@@ -233,6 +304,15 @@ func Package(bpDir, cacheDir, version, stack string, cached bool) (string, error
 	return zipFile, err
 }
 
+func containsFile(files []File, name string) bool {
+	for _, f := range files {
+		if filepath.Clean(f.Name) == filepath.Clean(name) {
+			return true
+		}
+	}
+	return false
+}
+
 func downloadFromURI(uri, fileName string) error {
 	err := os.MkdirAll(filepath.Dir(fileName), 0755)
 	if err != nil {
@@ -259,7 +339,16 @@ func downloadFromURI(uri, fileName string) error {
 		}
 		defer source.Close()
 	} else {
-		response, err := http.Get(uri)
+		httpOptions, err := libbuildpack.HTTPOptionsFromEnv()
+		if err != nil {
+			return err
+		}
+		client, err := libbuildpack.NewHTTPClient(httpOptions)
+		if err != nil {
+			return err
+		}
+
+		response, err := client.Get(uri)
 		if err != nil {
 			return err
 		}
@@ -276,18 +365,27 @@ func downloadFromURI(uri, fileName string) error {
 	return err
 }
 
-func checkSha256(filePath, expectedSha256 string) error {
-	content, err := ioutil.ReadFile(filePath)
+func checkDigests(filePath string, dependency libbuildpack.ManifestEntry) error {
+	fh, err := os.Open(filePath)
 	if err != nil {
 		return err
 	}
+	defer fh.Close()
 
-	sum := sha256.Sum256(content)
-
-	actualSha256 := hex.EncodeToString(sum[:])
+	sha256Hash, sha512Hash := sha256.New(), sha512.New()
+	if _, err := io.Copy(io.MultiWriter(sha256Hash, sha512Hash), fh); err != nil {
+		return err
+	}
 
-	if actualSha256 != expectedSha256 {
-		return fmt.Errorf("dependency sha256 mismatch: expected sha256 %s, actual sha256 %s", expectedSha256, actualSha256)
+	if dependency.SHA256 != "" || dependency.SHA512 == "" {
+		if actualSha256 := hex.EncodeToString(sha256Hash.Sum(nil)); actualSha256 != dependency.SHA256 {
+			return fmt.Errorf("dependency sha256 mismatch: expected sha256 %s, actual sha256 %s", dependency.SHA256, actualSha256)
+		}
+	}
+	if dependency.SHA512 != "" {
+		if actualSha512 := hex.EncodeToString(sha512Hash.Sum(nil)); actualSha512 != dependency.SHA512 {
+			return fmt.Errorf("dependency sha512 mismatch: expected sha512 %s, actual sha512 %s", dependency.SHA512, actualSha512)
+		}
 	}
 	return nil
 }
@@ -1,7 +1,11 @@
 package packager_test
 
 import (
+	"crypto/ed25519"
 	"crypto/md5"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -43,23 +47,23 @@ var _ = Describe("Packager", func() {
 		AfterEach(func() { os.Remove(zipFile) })
 
 		AssertStack := func() {
-			var manifest *packager.Manifest
+			var manifest *libbuildpack.Manifest
 			Context("stack specified and matches any dependency in manifest.yml", func() {
 				BeforeEach(func() { stack = "cflinuxfs2" })
 				JustBeforeEach(func() {
 					manifestYml, err := ZipContents(zipFile, "manifest.yml")
 					Expect(err).To(BeNil())
-					manifest = &packager.Manifest{}
+					manifest = &libbuildpack.Manifest{}
 					Expect(yaml.Unmarshal([]byte(manifestYml), manifest)).To(Succeed())
 				})
 
 				It("removes dependencies for other stacks from the manifest", func() {
-					Expect(len(manifest.Dependencies)).To(Equal(1))
-					Expect(manifest.Dependencies[0].SHA256).To(Equal("b11329c3fd6dbe9dddcb8dd90f18a4bf441858a6b5bfaccae5f91e5c7d2b3596"))
+					Expect(len(manifest.ManifestEntries)).To(Equal(1))
+					Expect(manifest.ManifestEntries[0].SHA256).To(Equal("b11329c3fd6dbe9dddcb8dd90f18a4bf441858a6b5bfaccae5f91e5c7d2b3596"))
 				})
 
 				It("removes cfstacks from the remaining dependencies", func() {
-					Expect(manifest.Dependencies[0].Stacks).To(BeNil())
+					Expect(manifest.ManifestEntries[0].CFStacks).To(BeNil())
 				})
 
 				It("adds a top-level stack: key to the manifest", func() {
@@ -72,12 +76,12 @@ var _ = Describe("Packager", func() {
 				JustBeforeEach(func() {
 					manifestYml, err := ZipContents(zipFile, "manifest.yml")
 					Expect(err).To(BeNil())
-					manifest = &packager.Manifest{}
+					manifest = &libbuildpack.Manifest{}
 					Expect(yaml.Unmarshal([]byte(manifestYml), manifest)).To(Succeed())
 				})
 
 				It("includes dependencies for all stacks in the manifest", func() {
-					Expect(len(manifest.Dependencies)).To(Equal(2))
+					Expect(len(manifest.ManifestEntries)).To(Equal(2))
 				})
 
 				It("does not add a top-level stack: key to the manifest", func() {
@@ -85,8 +89,8 @@ var _ = Describe("Packager", func() {
 				})
 
 				It("does not remove cf_stacks from dependencies", func() {
-					Expect(manifest.Dependencies[0].Stacks).To(Equal([]string{"cflinuxfs2"}))
-					Expect(manifest.Dependencies[1].Stacks).To(Equal([]string{"cflinuxfs3"}))
+					Expect(manifest.ManifestEntries[0].CFStacks).To(Equal([]string{"cflinuxfs2"}))
+					Expect(manifest.ManifestEntries[1].CFStacks).To(Equal([]string{"cflinuxfs3"}))
 				})
 			})
 		}
@@ -129,13 +133,26 @@ var _ = Describe("Packager", func() {
 				Expect(err.Error()).To(HavePrefix("dependencies/d39cae561ec1f485d1a4a58304e87105/rfc2324.txt not found in"))
 			})
 
+			It("keeps the order of the keys in manifest.yml", func() {
+				manifestYml, err := ZipContents(zipFile, "manifest.yml")
+				Expect(err).To(BeNil())
+				var m yaml.MapSlice
+				Expect(yaml.Unmarshal([]byte(manifestYml), &m)).To(Succeed())
+
+				var keys []interface{}
+				for _, item := range m {
+					keys = append(keys, item.Key)
+				}
+				Expect(keys).To(Equal([]interface{}{"language", "pre_package", "default_versions", "dependencies", "include_files", "stack"}))
+			})
+
 			It("does not set file on entries", func() {
 				manifestYml, err := ZipContents(zipFile, "manifest.yml")
 				Expect(err).To(BeNil())
-				var m packager.Manifest
+				var m libbuildpack.Manifest
 				Expect(yaml.Unmarshal([]byte(manifestYml), &m)).To(Succeed())
-				Expect(m.Dependencies).ToNot(BeEmpty())
-				Expect(m.Dependencies[0].File).To(Equal(""))
+				Expect(m.ManifestEntries).ToNot(BeEmpty())
+				Expect(m.ManifestEntries[0].File).To(Equal(""))
 			})
 		})
 
@@ -193,10 +210,10 @@ var _ = Describe("Packager", func() {
 			It("sets file on entries", func() {
 				manifestYml, err := ZipContents(zipFile, "manifest.yml")
 				Expect(err).To(BeNil())
-				var m packager.Manifest
+				var m libbuildpack.Manifest
 				Expect(yaml.Unmarshal([]byte(manifestYml), &m)).To(Succeed())
-				Expect(m.Dependencies).ToNot(BeEmpty())
-				Expect(m.Dependencies[0].File).To(Equal("dependencies/d39cae561ec1f485d1a4a58304e87105/rfc2324.txt"))
+				Expect(m.ManifestEntries).ToNot(BeEmpty())
+				Expect(m.ManifestEntries[0].File).To(Equal("dependencies/d39cae561ec1f485d1a4a58304e87105/rfc2324.txt"))
 			})
 
 			Context("dependency uses file://", func() {
@@ -282,6 +299,120 @@ var _ = Describe("Packager", func() {
 			})
 		})
 
+		Context("manifest.yml includes other manifests", func() {
+			BeforeEach(func() {
+				cached = false
+				buildpackDir = "./fixtures/includes"
+			})
+
+			It("flattens them into the packaged manifest.yml", func() {
+				zipFile, err = packager.Package(buildpackDir, cacheDir, version, stack, cached)
+				Expect(err).To(BeNil())
+
+				manifestYml, err := ZipContents(zipFile, "manifest.yml")
+				Expect(err).To(BeNil())
+				var m libbuildpack.Manifest
+				Expect(yaml.Unmarshal([]byte(manifestYml), &m)).To(Succeed())
+				Expect(m.ManifestEntries).To(HaveLen(2))
+				Expect(m.ManifestEntries[1].Name).To(Equal("bundler"))
+
+				_, err = ZipContents(zipFile, "manifest.d/bundler.yml")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("dependencies are limited to architectures", func() {
+			var m libbuildpack.Manifest
+			BeforeEach(func() {
+				cached = false
+				buildpackDir = "./fixtures/arch"
+			})
+			readManifest := func() {
+				manifestYml, err := ZipContents(zipFile, "manifest.yml")
+				Expect(err).To(BeNil())
+				m = libbuildpack.Manifest{}
+				Expect(yaml.Unmarshal([]byte(manifestYml), &m)).To(Succeed())
+			}
+
+			It("only packages the dependencies for the arch", func() {
+				zipFile, err = packager.PackageForArch(buildpackDir, cacheDir, version, stack, "arm64", cached)
+				Expect(err).To(BeNil())
+				readManifest()
+
+				Expect(m.ManifestEntries).To(HaveLen(2))
+				Expect(m.ManifestEntries[0].URI).To(Equal("https://www.ietf.org/rfc/rfc2324.txt?arm64"))
+				Expect(m.ManifestEntries[0].Arch).To(Equal("arm64"))
+				Expect(m.ManifestEntries[1].Name).To(Equal("bundler"))
+			})
+
+			It("packages the dependencies for every arch without an arch", func() {
+				zipFile, err = packager.PackageForArch(buildpackDir, cacheDir, version, stack, "", cached)
+				Expect(err).To(BeNil())
+				readManifest()
+
+				Expect(m.ManifestEntries).To(HaveLen(3))
+			})
+
+			It("packages the dependencies for every arch by default, whatever arch packages them", func() {
+				zipFile, err = packager.Package(buildpackDir, cacheDir, version, stack, cached)
+				Expect(err).To(BeNil())
+				readManifest()
+
+				Expect(m.ManifestEntries).To(HaveLen(3))
+			})
+
+			It("requires a default version for the arch", func() {
+				zipFile, err = packager.PackageForArch(buildpackDir, cacheDir, version, stack, "s390x", cached)
+				Expect(err).To(MatchError("No matching default dependency `ruby` for stack `cflinuxfs2`"))
+			})
+		})
+
+		Context("dependency metadata is invalid", func() {
+			var tmpDir string
+			BeforeEach(func() {
+				tmpDir, err = ioutil.TempDir("", "packager-metadata")
+				Expect(err).To(BeNil())
+				buildpackDir = tmpDir
+			})
+			AfterEach(func() { os.RemoveAll(tmpDir) })
+
+			writeManifest := func(metadata string) {
+				Expect(ioutil.WriteFile(filepath.Join(tmpDir, "manifest.yml"), []byte(`---
+language: ruby
+dependencies:
+- name: ruby
+  version: 1.2.3
+  sha256: b11329c3fd6dbe9dddcb8dd90f18a4bf441858a6b5bfaccae5f91e5c7d2b3596
+  uri: https://www.ietf.org/rfc/rfc2324.txt
+  cf_stacks: [cflinuxfs2]
+`+metadata), 0644)).To(Succeed())
+			}
+
+			It("rejects malformed cpes", func() {
+				writeManifest("  cpe: ruby-lang:ruby\n")
+				zipFile, err = packager.Package(buildpackDir, cacheDir, version, stack, cached)
+				Expect(err).To(MatchError("Dependency `ruby` `1.2.3` has an invalid cpe ruby-lang:ruby"))
+			})
+
+			It("rejects malformed purls", func() {
+				writeManifest("  purl: generic/ruby@1.2.3\n")
+				zipFile, err = packager.Package(buildpackDir, cacheDir, version, stack, cached)
+				Expect(err).To(MatchError("Dependency `ruby` `1.2.3` has an invalid purl generic/ruby@1.2.3"))
+			})
+
+			It("rejects a source_sha256 without source", func() {
+				writeManifest("  source_sha256: 646b43b5d718913d6211e2c18b2b3b667cf6eaa76a2493e55b1de5ca04c2578e\n")
+				zipFile, err = packager.Package(buildpackDir, cacheDir, version, stack, cached)
+				Expect(err).To(MatchError("Dependency `ruby` `1.2.3` has a source_sha256 but no source"))
+			})
+
+			It("rejects malformed source_sha256", func() {
+				writeManifest("  source: https://example.com/ruby.tgz\n  source_sha256: abc\n")
+				zipFile, err = packager.Package(buildpackDir, cacheDir, version, stack, cached)
+				Expect(err).To(MatchError("Dependency `ruby` `1.2.3` has an invalid source_sha256: expected 64 lowercase hex characters, got 3 characters"))
+			})
+		})
+
 		Context("when buildpack includes symlink to directory", func() {
 			BeforeEach(func() {
 				// this is actually a failing test....
@@ -339,6 +470,66 @@ var _ = Describe("Packager", func() {
 			})
 		})
 
+		Context("cached dependency declares a signature", func() {
+			var (
+				tempfile string
+				private  ed25519.PrivateKey
+			)
+
+			BeforeEach(func() {
+				cached = true
+				tempdir, err := ioutil.TempDir("", "bp_fixture")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(libbuildpack.CopyDirectory("./fixtures/good", tempdir)).To(Succeed())
+
+				public, privateKey, err := ed25519.GenerateKey(rand.Reader)
+				Expect(err).ToNot(HaveOccurred())
+				private = privateKey
+				der, err := x509.MarshalPKIXPublicKey(public)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(tempdir, "dependency.pub"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644)).To(Succeed())
+
+				fh, err := ioutil.TempFile("", "bp_dependency")
+				Expect(err).ToNot(HaveOccurred())
+				fh.WriteString("keaty")
+				fh.Close()
+				tempfile = fh.Name()
+
+				manifestyml, err := ioutil.ReadFile(filepath.Join(tempdir, "manifest.yml"))
+				Expect(err).ToNot(HaveOccurred())
+				manifestyml2 := string(manifestyml)
+				manifestyml2 = strings.Replace(manifestyml2, "https://www.ietf.org/rfc/rfc2324.txt", "file://"+tempfile, -1)
+				manifestyml2 = strings.Replace(manifestyml2, "b11329c3fd6dbe9dddcb8dd90f18a4bf441858a6b5bfaccae5f91e5c7d2b3596", "f909ee4c4bec3280bbbff6b41529479366ab10c602d8aed33e3a86f0a9c5db4e\n  signature_uri: file://"+tempfile+".sig\n  public_key: dependency.pub", -1)
+				Expect(ioutil.WriteFile(filepath.Join(tempdir, "manifest.yml"), []byte(manifestyml2), 0644)).To(Succeed())
+
+				buildpackDir = tempdir
+			})
+			AfterEach(func() {
+				os.RemoveAll(buildpackDir)
+				os.Remove(tempfile)
+				os.Remove(tempfile + ".sig")
+			})
+
+			It("includes the verified signature and the public key", func() {
+				Expect(ioutil.WriteFile(tempfile+".sig", ed25519.Sign(private, []byte("keaty")), 0644)).To(Succeed())
+
+				zipFile, err = packager.Package(buildpackDir, cacheDir, version, stack, cached)
+				Expect(err).To(BeNil())
+
+				sigFile := filepath.Join("dependencies", fmt.Sprintf("%x", md5.Sum([]byte("file://"+tempfile+".sig"))), filepath.Base(tempfile)+".sig")
+				Expect(ZipContents(zipFile, sigFile)).ToNot(BeEmpty())
+				Expect(ZipContents(zipFile, "dependency.pub")).To(ContainSubstring("PUBLIC KEY"))
+				Expect(ZipContents(zipFile, "manifest.yml")).To(ContainSubstring("signature_file: " + sigFile))
+			})
+
+			It("fails when the signature does not match", func() {
+				Expect(ioutil.WriteFile(tempfile+".sig", ed25519.Sign(private, []byte("other")), 0644)).To(Succeed())
+
+				zipFile, err = packager.Package(buildpackDir, cacheDir, version, stack, cached)
+				Expect(err).To(MatchError(ContainSubstring("signature mismatch")))
+			})
+		})
+
 		Context("packaging with no stack", func() {
 			BeforeEach(func() {
 				cached = false
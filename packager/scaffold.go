@@ -93,12 +93,12 @@ func Scaffold(bpDir string, languageName string) error {
 }
 
 func Upgrade(bpDir string, force bool) error {
-	manifest, err := readManifest(bpDir)
+	manifest, err := libbuildpack.ReadManifest(bpDir)
 	if err != nil {
 		return fmt.Errorf("error opening manifest: %s", err)
 	}
 
-	return generateAssets(bpDir, manifest.Language, force)
+	return generateAssets(bpDir, manifest.Language(), force)
 }
 
 func readShaYML(bpDir string) (map[string]string, error) {
@@ -117,16 +117,3 @@ func readShaYML(bpDir string) (map[string]string, error) {
 	}
 	return map[string]string{}, nil
 }
-
-func readManifest(bpDir string) (*Manifest, error) {
-	manifest := &Manifest{}
-	data, err := ioutil.ReadFile(filepath.Join(bpDir, "manifest.yml"))
-	if err != nil {
-		return nil, err
-	}
-	if err := yaml.Unmarshal(data, manifest); err != nil {
-		return nil, err
-	}
-
-	return manifest, nil
-}
@@ -2,60 +2,115 @@ package packager
 
 import (
 	"fmt"
-	"io/ioutil"
-	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
-	yaml "gopkg.in/yaml.v2"
+	"github.com/cloudfoundry/libbuildpack"
 )
 
+// Summary is SummaryAt the current time
 func Summary(bpDir string) (string, error) {
-	manifest := Manifest{}
-	data, err := ioutil.ReadFile(filepath.Join(bpDir, "manifest.yml"))
+	return SummaryAt(bpDir, time.Now())
+}
+
+// SummaryAt renders the dependencies, default versions and the deprecations
+// upcoming at now of the buildpack in bpDir as markdown tables. Deprecations
+// with malformed dates are listed with the date marked invalid.
+func SummaryAt(bpDir string, now time.Time) (string, error) {
+	manifest, err := libbuildpack.ReadManifest(bpDir)
 	if err != nil {
 		return "", err
 	}
-	if err := yaml.Unmarshal(data, &manifest); err != nil {
-		return "", err
+
+	columns := []struct {
+		header string
+		value  func(d libbuildpack.ManifestEntry) string
+	}{
+		{"name", func(d libbuildpack.ManifestEntry) string { return d.Name }},
+		{"version", func(d libbuildpack.ManifestEntry) string { return d.Version }},
+		{"cf_stacks", func(d libbuildpack.ManifestEntry) string { return sortedList(d.CFStacks) }},
+		{"arch", func(d libbuildpack.ManifestEntry) string { return d.Arch }},
+		{"os", func(d libbuildpack.ManifestEntry) string { return d.OS }},
+		{"modules", func(d libbuildpack.ManifestEntry) string { return sortedList(d.Modules) }},
+		{"licenses", func(d libbuildpack.ManifestEntry) string { return sortedList(d.Licenses) }},
+		{"cpe", func(d libbuildpack.ManifestEntry) string { return d.CPE }},
+		{"purl", func(d libbuildpack.ManifestEntry) string { return d.PURL }},
+		{"source", func(d libbuildpack.ManifestEntry) string { return d.Source }},
 	}
 
-	hasModules := false
-	for _, d := range manifest.Dependencies {
-		if len(d.Modules) > 0 {
-			hasModules = true
-			break
+	// name, version and cf_stacks are always shown, the other columns only if used
+	var headers []string
+	var values []func(d libbuildpack.ManifestEntry) string
+	for idx, c := range columns {
+		used := idx < 3
+		for _, d := range manifest.ManifestEntries {
+			if c.value(d) != "" {
+				used = true
+				break
+			}
+		}
+		if used {
+			headers = append(headers, c.header)
+			values = append(values, c.value)
 		}
 	}
 
 	var out string
-	if len(manifest.Dependencies) > 0 {
+	if len(manifest.ManifestEntries) > 0 {
 		out = "\nPackaged binaries:\n\n"
-		sort.Sort(manifest.Dependencies)
-		if hasModules {
-			out += "| name | version | cf_stacks | modules |\n|-|-|-|-|\n"
-		} else {
-			out += "| name | version | cf_stacks |\n|-|-|-|\n"
-		}
+		sort.Sort(manifestEntries(manifest.ManifestEntries))
+		out += "| " + strings.Join(headers, " | ") + " |\n|" + strings.Repeat("-|", len(headers)) + "\n"
 	}
 
-	for _, d := range manifest.Dependencies {
-		sort.Strings(d.Stacks)
-		if hasModules {
-			sort.Strings(d.Modules)
-			out += fmt.Sprintf("| %s | %s | %s | %s |\n", d.Name, d.Version, strings.Join(d.Stacks, ", "), strings.Join(d.Modules, ", "))
-		} else {
-			out += fmt.Sprintf("| %s | %s | %s |\n", d.Name, d.Version, strings.Join(d.Stacks, ", "))
+	for _, d := range manifest.ManifestEntries {
+		row := make([]string, len(values))
+		for idx, value := range values {
+			row[idx] = value(d)
 		}
+		out += "| " + strings.Join(row, " | ") + " |\n"
 	}
 
-	if len(manifest.Defaults) > 0 {
+	if len(manifest.DefaultVersions) > 0 {
 		out += "\nDefault binary versions:\n\n"
 		out += "| name | version |\n|-|-|\n"
-		for _, d := range manifest.Defaults {
+		for _, d := range manifest.DefaultVersions {
 			out += fmt.Sprintf("| %s | %s |\n", d.Name, d.Version)
 		}
 	}
 
+	var invalid []libbuildpack.DeprecationDate
+	valid := *manifest
+	valid.Deprecations = nil
+	for _, d := range manifest.Deprecations {
+		if _, err := time.Parse(deprecationDateFormat, d.Date); err != nil {
+			invalid = append(invalid, d)
+		} else {
+			valid.Deprecations = append(valid.Deprecations, d)
+		}
+	}
+	upcoming, err := valid.UpcomingDeprecations(now, 0)
+	if err != nil {
+		return "", err
+	}
+	if len(upcoming)+len(invalid) > 0 {
+		out += "\nUpcoming deprecations:\n\n"
+		out += "| name | version line | date | link |\n|-|-|-|-|\n"
+		for _, d := range upcoming {
+			out += fmt.Sprintf("| %s | %s | %s | %s |\n", d.Name, d.VersionLine, d.Date, d.Link)
+		}
+		for _, d := range invalid {
+			out += fmt.Sprintf("| %s | %s | %s (invalid) | %s |\n", d.Name, d.VersionLine, d.Date, d.Link)
+		}
+	}
+
 	return out, nil
 }
+
+const deprecationDateFormat = "2006-01-02"
+
+func sortedList(list []string) string {
+	sorted := append([]string{}, list...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
@@ -1,6 +1,8 @@
 package packager_test
 
 import (
+	"time"
+
 	"github.com/cloudfoundry/libbuildpack/packager"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -53,6 +55,54 @@ Packaged binaries:
 			})
 		})
 
+		Context("dependencies declare licenses and identifiers", func() {
+			BeforeEach(func() {
+				buildpackDir = "./fixtures/metadata"
+			})
+			It("Renders tables of dependencies (including metadata)", func() {
+				Expect(packager.Summary(buildpackDir)).To(Equal(`
+Packaged binaries:
+
+| name | version | cf_stacks | licenses | cpe | purl | source |
+|-|-|-|-|-|-|-|
+| bundler | 2.0.1 | cflinuxfs2 | MIT |  |  |  |
+| ruby | 1.2.3 | cflinuxfs2 | BSD-2-Clause, Ruby | cpe:2.3:a:ruby-lang:ruby:1.2.3:*:*:*:*:*:*:* | pkg:generic/ruby@1.2.3 | https://cache.ruby-lang.org/pub/ruby/ruby-1.2.3.tar.gz |
+`))
+			})
+		})
+
+		Context("dependencies are deprecated", func() {
+			BeforeEach(func() {
+				buildpackDir = "./fixtures/deprecations"
+			})
+			It("Renders a table of the upcoming deprecations, marking malformed dates", func() {
+				Expect(packager.SummaryAt(buildpackDir, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))).To(Equal(`
+Packaged binaries:
+
+| name | version | cf_stacks |
+|-|-|-|
+| ruby | 1.2.3 | cflinuxfs2 |
+
+Upcoming deprecations:
+
+| name | version line | date | link |
+|-|-|-|-|
+| bundler | 2.x | 2998-12-24 |  |
+| ruby | 1.2.x | 2999-03-31 | https://www.ruby-lang.org/en/downloads/branches/ |
+| node | 18.x | end of 2999 (invalid) |  |
+`))
+			})
+
+			It("only lists the deprecations after the given time", func() {
+				Expect(packager.SummaryAt(buildpackDir, time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC))).To(ContainSubstring(`
+| name | version line | date | link |
+|-|-|-|-|
+| ruby | 1.2.x | 2999-03-31 | https://www.ruby-lang.org/en/downloads/branches/ |
+| node | 18.x | end of 2999 (invalid) |  |
+`))
+			})
+		})
+
 		Context("no dependencies", func() {
 			BeforeEach(func() {
 				buildpackDir = "./fixtures/no_dependencies"
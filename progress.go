@@ -0,0 +1,173 @@
+package libbuildpack
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ProgressInterval is the least time between two progress lines of a transfer
+var ProgressInterval = 5 * time.Second
+
+// Progress reports the bytes written to it by a long running transfer. It
+// prints nothing unless its Logger writes to a terminal. A nil Progress
+// discards everything.
+type Progress struct {
+	log     *Logger
+	label   string
+	total   int64
+	done    int64
+	start   time.Time
+	printed time.Time
+	mu      sync.Mutex
+}
+
+// StepTiming is how long a step started with BeginStep took
+type StepTiming struct {
+	Name     string
+	Duration time.Duration
+}
+
+// ShowProgress overrides whether progress is printed, which by default
+// depends on whether the Logger writes to a terminal
+func (l *Logger) ShowProgress(show bool) {
+	l.mu.Lock()
+	l.showProgress = &show
+	l.mu.Unlock()
+}
+
+func (l *Logger) progressShown() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.showProgress != nil {
+		return *l.showProgress
+	}
+	f, ok := l.w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Progress starts reporting a transfer of total bytes; total may be zero when unknown
+func (l *Logger) Progress(label string, total int64) *Progress {
+	if !l.progressShown() {
+		return nil
+	}
+	now := time.Now()
+	return &Progress{log: l, label: label, total: total, start: now, printed: now}
+}
+
+func (p *Progress) Write(b []byte) (int, error) {
+	if p == nil {
+		return len(b), nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done += int64(len(b))
+	if now := time.Now(); now.Sub(p.printed) >= ProgressInterval {
+		p.printed = now
+		p.print(now)
+	}
+	return len(b), nil
+}
+
+// SetTotal changes the expected size, once it is known
+func (p *Progress) SetTotal(total int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.total = total
+	p.mu.Unlock()
+}
+
+// Reset starts counting from zero again, e.g. when a download restarts
+func (p *Progress) Reset() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.done = 0
+	p.mu.Unlock()
+}
+
+// Done prints the final size and throughput, if any progress was printed before
+func (p *Progress) Done() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.printed != p.start {
+		p.print(time.Now())
+	}
+}
+
+func (p *Progress) print(now time.Time) {
+	var rate string
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		rate = fmt.Sprintf(" (%s/s)", formatBytes(int64(float64(p.done)/elapsed)))
+	}
+	if p.total > 0 {
+		p.log.Info("%s %s of %s%s", p.label, formatBytes(p.done), formatBytes(p.total), rate)
+	} else {
+		p.log.Info("%s %s%s", p.label, formatBytes(p.done), rate)
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func (l *Logger) startStep(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if n := len(l.steps); n > 0 && l.steps[n-1].Duration == 0 {
+		l.steps[n-1].Duration = now.Sub(l.stepStart)
+	}
+	l.steps = append(l.steps, StepTiming{Name: name})
+	l.stepStart = now
+}
+
+// StepTimings lists every step begun so far; the running step is timed until now
+func (l *Logger) StepTimings() []StepTiming {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	steps := append([]StepTiming{}, l.steps...)
+	if n := len(steps); n > 0 && steps[n-1].Duration == 0 {
+		steps[n-1].Duration = time.Since(l.stepStart)
+	}
+	return steps
+}
+
+// LogStepTimings prints how long every step took
+func (l *Logger) LogStepTimings() {
+	steps := l.StepTimings()
+	if len(steps) == 0 {
+		return
+	}
+
+	l.printWithHeader("----->", "Step durations")
+	for _, step := range steps {
+		l.Info("%s: %s", step.Name, step.Duration.Round(time.Millisecond))
+	}
+}
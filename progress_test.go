@@ -0,0 +1,96 @@
+package libbuildpack_test
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Progress", func() {
+	var (
+		logger      *libbuildpack.Logger
+		buffer      *bytes.Buffer
+		oldInterval time.Duration
+	)
+
+	BeforeEach(func() {
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(ansicleaner.New(buffer))
+		oldInterval = libbuildpack.ProgressInterval
+		libbuildpack.ProgressInterval = 0
+	})
+	AfterEach(func() { libbuildpack.ProgressInterval = oldInterval })
+
+	It("prints nothing when the output is not a terminal", func() {
+		progress := logger.Progress("Downloading", 100)
+		progress.Write(make([]byte, 50))
+		progress.Done()
+
+		Expect(buffer.String()).To(BeEmpty())
+	})
+
+	Context("progress is shown", func() {
+		BeforeEach(func() { logger.ShowProgress(true) })
+
+		It("prints bytes, total and throughput", func() {
+			progress := logger.Progress("Downloading", 4096)
+			progress.Write(make([]byte, 2048))
+
+			Expect(buffer.String()).To(MatchRegexp(`       Downloading 2\.0 KiB of 4\.0 KiB \(.+/s\)\n`))
+		})
+
+		It("omits the total when it is unknown", func() {
+			progress := logger.Progress("Extracting", 0)
+			progress.Write(make([]byte, 10))
+
+			Expect(buffer.String()).To(MatchRegexp(`       Extracting 10 B \(.+/s\)\n`))
+		})
+
+		It("throttles the output", func() {
+			libbuildpack.ProgressInterval = time.Hour
+			progress := logger.Progress("Downloading", 0)
+			for i := 0; i < 10; i++ {
+				progress.Write(make([]byte, 10))
+			}
+			progress.Done()
+
+			Expect(buffer.String()).To(BeEmpty())
+		})
+
+		It("counts from zero after Reset", func() {
+			progress := logger.Progress("Downloading", 0)
+			progress.Write(make([]byte, 10))
+			progress.Reset()
+			progress.Write(make([]byte, 5))
+
+			Expect(strings.Split(strings.TrimSpace(buffer.String()), "\n")[1]).To(ContainSubstring("Downloading 5 B"))
+		})
+	})
+
+	Describe("StepTimings", func() {
+		It("times every step", func() {
+			logger.BeginStep("Installing %s", "node")
+			time.Sleep(10 * time.Millisecond)
+			logger.BeginStep("Installing %s", "yarn")
+
+			steps := logger.StepTimings()
+			Expect(steps).To(HaveLen(2))
+			Expect(steps[0].Name).To(Equal("Installing node"))
+			Expect(steps[0].Duration).To(BeNumerically(">=", 10*time.Millisecond))
+			Expect(steps[1].Name).To(Equal("Installing yarn"))
+		})
+
+		It("logs a summary", func() {
+			logger.BeginStep("Installing node")
+			logger.LogStepTimings()
+
+			Expect(buffer.String()).To(ContainSubstring("-----> Step durations\n"))
+			Expect(buffer.String()).To(MatchRegexp(`       Installing node: .+s\n`))
+		})
+	})
+})
@@ -0,0 +1,413 @@
+package libbuildpack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// SBOMFormat selects the document written by Stager.WriteSBOM
+type SBOMFormat string
+
+const (
+	CycloneDX SBOMFormat = "cyclonedx"
+	SPDX      SBOMFormat = "spdx"
+)
+
+func (f SBOMFormat) fileName() (string, error) {
+	switch f {
+	case CycloneDX:
+		return "sbom.cdx.json", nil
+	case SPDX:
+		return "sbom.spdx.json", nil
+	default:
+		return "", fmt.Errorf("unknown SBOM format %s", f)
+	}
+}
+
+type cycloneDXDocument struct {
+	BOMFormat   string `json:"bomFormat"`
+	SpecVersion string `json:"specVersion"`
+	Version     int    `json:"version"`
+	Metadata    struct {
+		Timestamp string          `json:"timestamp"`
+		Tools     []cycloneDXTool `json:"tools"`
+	} `json:"metadata"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXTool struct {
+	Vendor  string `json:"vendor"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type cycloneDXComponent struct {
+	Type               string              `json:"type"`
+	BOMRef             string              `json:"bom-ref"`
+	Name               string              `json:"name"`
+	Version            string              `json:"version"`
+	PURL               string              `json:"purl,omitempty"`
+	CPE                string              `json:"cpe,omitempty"`
+	Hashes             []cycloneDXHash     `json:"hashes,omitempty"`
+	Licenses           []cycloneDXLicense  `json:"licenses,omitempty"`
+	ExternalReferences []cycloneDXRef      `json:"externalReferences,omitempty"`
+	Properties         []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXLicense struct {
+	License struct {
+		Name string `json:"name"`
+	} `json:"license"`
+}
+
+type cycloneDXRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+}
+
+type spdxDocument struct {
+	SPDXVersion       string `json:"spdxVersion"`
+	DataLicense       string `json:"dataLicense"`
+	SPDXID            string `json:"SPDXID"`
+	Name              string `json:"name"`
+	DocumentNamespace string `json:"documentNamespace"`
+	CreationInfo      struct {
+		Created  string   `json:"created"`
+		Creators []string `json:"creators"`
+	} `json:"creationInfo"`
+	Packages                   []spdxPackage          `json:"packages"`
+	HasExtractedLicensingInfos []spdxExtractedLicense `json:"hasExtractedLicensingInfos,omitempty"`
+}
+
+// spdxExtractedLicense declares a LicenseRef, named as in the manifest
+type spdxExtractedLicense struct {
+	LicenseID     string `json:"licenseId"`
+	ExtractedText string `json:"extractedText"`
+	Name          string `json:"name"`
+}
+
+type spdxPackage struct {
+	Name             string         `json:"name"`
+	SPDXID           string         `json:"SPDXID"`
+	VersionInfo      string         `json:"versionInfo"`
+	DownloadLocation string         `json:"downloadLocation"`
+	FilesAnalyzed    bool           `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum `json:"checksums,omitempty"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	LicenseDeclared  string         `json:"licenseDeclared"`
+	ExternalRefs     []spdxRef      `json:"externalRefs,omitempty"`
+	Comment          string         `json:"comment,omitempty"`
+}
+
+type spdxRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+const (
+	spdxNoAssertion  = "NOASSERTION"
+	spdxStacksPrefix = "cf_stacks: "
+)
+
+// sbomURI is uri with its credentials redacted, as the SBOM ships in the
+// droplet; a uri that cannot be parsed is left out
+func sbomURI(uri string) string {
+	filtered, err := filterURI(uri)
+	if err != nil {
+		return ""
+	}
+	return filtered
+}
+
+// libbuildpackVersion is the version of the libbuildpack module built into
+// the running buildpack, if the build recorded it
+func libbuildpackVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, module := range append([]*debug.Module{&info.Main}, info.Deps...) {
+		if module.Path == "github.com/cloudfoundry/libbuildpack" && module.Version != "(devel)" {
+			return module.Version
+		}
+	}
+	return ""
+}
+
+func writeCycloneDX(file string, entries []ManifestEntry, now time.Time) error {
+	doc := cycloneDXDocument{BOMFormat: "CycloneDX", SpecVersion: "1.4", Version: 1}
+	doc.Metadata.Timestamp = now.UTC().Format(time.RFC3339)
+	doc.Metadata.Tools = []cycloneDXTool{{Vendor: "Cloud Foundry", Name: "libbuildpack", Version: libbuildpackVersion()}}
+
+	doc.Components = []cycloneDXComponent{}
+	for _, entry := range entries {
+		c := cycloneDXComponent{
+			Type:    "library",
+			BOMRef:  entry.Dependency.Name + "@" + entry.Dependency.Version,
+			Name:    entry.Dependency.Name,
+			Version: entry.Dependency.Version,
+			PURL:    entry.PURL,
+			CPE:     entry.CPE,
+		}
+		if entry.SHA256 != "" {
+			c.Hashes = append(c.Hashes, cycloneDXHash{"SHA-256", entry.SHA256})
+		}
+		if entry.SHA512 != "" {
+			c.Hashes = append(c.Hashes, cycloneDXHash{"SHA-512", entry.SHA512})
+		}
+		for _, license := range entry.Licenses {
+			var l cycloneDXLicense
+			l.License.Name = license
+			c.Licenses = append(c.Licenses, l)
+		}
+		if uri := sbomURI(entry.URI); uri != "" {
+			c.ExternalReferences = append(c.ExternalReferences, cycloneDXRef{"distribution", uri})
+		}
+		if len(entry.CFStacks) > 0 {
+			c.Properties = append(c.Properties, cycloneDXProperty{"cf_stacks", strings.Join(entry.CFStacks, ",")})
+		}
+		doc.Components = append(doc.Components, c)
+	}
+
+	return NewJSON().Write(file, doc)
+}
+
+func readCycloneDX(file string) ([]ManifestEntry, error) {
+	var doc cycloneDXDocument
+	if err := NewJSON().Load(file, &doc); err != nil {
+		return nil, err
+	}
+
+	var entries []ManifestEntry
+	for _, c := range doc.Components {
+		entry := ManifestEntry{Dependency: Dependency{Name: c.Name, Version: c.Version}, PURL: c.PURL, CPE: c.CPE}
+		for _, hash := range c.Hashes {
+			switch hash.Alg {
+			case "SHA-256":
+				entry.SHA256 = hash.Content
+			case "SHA-512":
+				entry.SHA512 = hash.Content
+			}
+		}
+		for _, license := range c.Licenses {
+			entry.Licenses = append(entry.Licenses, license.License.Name)
+		}
+		for _, ref := range c.ExternalReferences {
+			if ref.Type == "distribution" {
+				entry.URI = ref.URL
+			}
+		}
+		for _, property := range c.Properties {
+			if property.Name == "cf_stacks" && property.Value != "" {
+				entry.CFStacks = strings.Split(property.Value, ",")
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func writeSPDX(file, name string, entries []ManifestEntry, now time.Time) error {
+	doc := spdxDocument{
+		SPDXVersion: "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		SPDXID:      "SPDXRef-DOCUMENT",
+		Name:        name,
+	}
+	doc.CreationInfo.Created = now.UTC().Format(time.RFC3339)
+	doc.CreationInfo.Creators = []string{"Tool: libbuildpack"}
+
+	namespace := sha256.New()
+	fmt.Fprintf(namespace, "%s %s", name, doc.CreationInfo.Created)
+
+	doc.Packages = []spdxPackage{}
+	extracted := map[string]bool{}
+	for idx, entry := range entries {
+		p := spdxPackage{
+			Name:             entry.Dependency.Name,
+			SPDXID:           fmt.Sprintf("SPDXRef-Package-%d", idx+1),
+			VersionInfo:      entry.Dependency.Version,
+			DownloadLocation: sbomURI(entry.URI),
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  spdxNoAssertion,
+		}
+		if p.DownloadLocation == "" {
+			p.DownloadLocation = spdxNoAssertion
+		}
+		if entry.SHA256 != "" {
+			p.Checksums = append(p.Checksums, spdxChecksum{"SHA256", entry.SHA256})
+		}
+		if entry.SHA512 != "" {
+			p.Checksums = append(p.Checksums, spdxChecksum{"SHA512", entry.SHA512})
+		}
+		var licenses []string
+		for _, license := range entry.Licenses {
+			id := spdxLicense(license)
+			if id == "" || containsString(licenses, id) {
+				continue
+			}
+			licenses = append(licenses, id)
+			if strings.HasPrefix(id, spdxLicenseRefPrefix) && !extracted[id] {
+				extracted[id] = true
+				doc.HasExtractedLicensingInfos = append(doc.HasExtractedLicensingInfos, spdxExtractedLicense{id, license, license})
+			}
+		}
+		if len(licenses) > 0 {
+			p.LicenseDeclared = strings.Join(licenses, " AND ")
+		}
+		if entry.PURL != "" {
+			p.ExternalRefs = append(p.ExternalRefs, spdxRef{"PACKAGE-MANAGER", "purl", entry.PURL})
+		}
+		if entry.CPE != "" {
+			p.ExternalRefs = append(p.ExternalRefs, spdxRef{"SECURITY", spdxCPEType(entry.CPE), entry.CPE})
+		}
+		if len(entry.CFStacks) > 0 {
+			p.Comment = spdxStacksPrefix + strings.Join(entry.CFStacks, ",")
+		}
+		fmt.Fprintf(namespace, " %s@%s", p.Name, p.VersionInfo)
+		doc.Packages = append(doc.Packages, p)
+	}
+	doc.DocumentNamespace = "https://cloudfoundry.org/spdxdocs/" + hex.EncodeToString(namespace.Sum(nil))
+
+	return NewJSON().Write(file, doc)
+}
+
+// spdxCPEType is the SPDX reference type of cpe, a CPE 2.2 URI (cpe:/...) or
+// a CPE 2.3 formatted string (cpe:2.3:...)
+func spdxCPEType(cpe string) string {
+	if strings.HasPrefix(cpe, "cpe:/") {
+		return "cpe22Type"
+	}
+	return "cpe23Type"
+}
+
+func readSPDX(file string) ([]ManifestEntry, error) {
+	var doc spdxDocument
+	if err := NewJSON().Load(file, &doc); err != nil {
+		return nil, err
+	}
+
+	names := map[string]string{}
+	for _, license := range doc.HasExtractedLicensingInfos {
+		names[license.LicenseID] = license.Name
+	}
+
+	var entries []ManifestEntry
+	for _, p := range doc.Packages {
+		entry := ManifestEntry{Dependency: Dependency{Name: p.Name, Version: p.VersionInfo}}
+		if p.DownloadLocation != spdxNoAssertion {
+			entry.URI = p.DownloadLocation
+		}
+		for _, checksum := range p.Checksums {
+			switch checksum.Algorithm {
+			case "SHA256":
+				entry.SHA256 = checksum.ChecksumValue
+			case "SHA512":
+				entry.SHA512 = checksum.ChecksumValue
+			}
+		}
+		if p.LicenseDeclared != "" && p.LicenseDeclared != spdxNoAssertion {
+			for _, license := range strings.Split(p.LicenseDeclared, " AND ") {
+				if name, ok := names[license]; ok {
+					license = name
+				}
+				entry.Licenses = append(entry.Licenses, license)
+			}
+		}
+		for _, ref := range p.ExternalRefs {
+			switch ref.ReferenceType {
+			case "purl":
+				entry.PURL = ref.ReferenceLocator
+			case "cpe22Type", "cpe23Type":
+				entry.CPE = ref.ReferenceLocator
+			}
+		}
+		if strings.HasPrefix(p.Comment, spdxStacksPrefix) {
+			entry.CFStacks = strings.Split(strings.TrimPrefix(p.Comment, spdxStacksPrefix), ",")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// WriteSBOM records entries, usually Installer.InstalledDependencies, in the dep dir
+func (s *Stager) WriteSBOM(entries []ManifestEntry, format SBOMFormat) error {
+	fileName, err := format.fileName()
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(s.DepDir(), fileName)
+
+	if format == SPDX {
+		return writeSPDX(file, s.manifest.Language()+" buildpack dependencies", entries, time.Now())
+	}
+	return writeCycloneDX(file, entries, time.Now())
+}
+
+// ReadSBOM lists the dependencies recorded in the SBOM of dir, e.g. a dep dir
+func ReadSBOM(dir string, format SBOMFormat) ([]ManifestEntry, error) {
+	fileName, err := format.fileName()
+	if err != nil {
+		return nil, err
+	}
+	file := filepath.Join(dir, fileName)
+
+	if format == SPDX {
+		return readSPDX(file)
+	}
+	return readCycloneDX(file)
+}
+
+// MergeSBOMs rewrites the SBOM in the dep dir to hold the dependencies of
+// every buildpack that wrote one; the final buildpack calls it when it is done
+func (s *Stager) MergeSBOMs(format SBOMFormat) error {
+	fileName, err := format.fileName()
+	if err != nil {
+		return err
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.depsDir, "*", fileName))
+	if err != nil {
+		return err
+	}
+
+	var merged []ManifestEntry
+	seen := map[string]bool{}
+	for _, file := range files {
+		entries, err := ReadSBOM(filepath.Dir(file), format)
+		if err != nil {
+			return fmt.Errorf("could not read %s: %v", file, err)
+		}
+
+		for _, entry := range entries {
+			key := strings.Join([]string{entry.Dependency.Name, entry.Dependency.Version, entry.URI, entry.SHA256, entry.SHA512}, " ")
+			if !seen[key] {
+				seen[key] = true
+				merged = append(merged, entry)
+			}
+		}
+	}
+
+	return s.WriteSBOM(merged, format)
+}
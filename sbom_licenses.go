@@ -0,0 +1,56 @@
+package libbuildpack
+
+import (
+	"regexp"
+	"strings"
+)
+
+// spdxLicenseIDs are the SPDX license list identifiers found in buildpack
+// manifests, by lower case id. Other licenses are written as LicenseRefs.
+var spdxLicenseIDs = func() map[string]string {
+	ids := map[string]string{}
+	for _, id := range []string{
+		"0BSD", "AFL-2.1", "AFL-3.0", "AGPL-3.0-only", "AGPL-3.0-or-later",
+		"Apache-1.1", "Apache-2.0", "APSL-2.0", "Artistic-1.0", "Artistic-1.0-Perl",
+		"Artistic-2.0", "BlueOak-1.0.0", "BSD-1-Clause", "BSD-2-Clause",
+		"BSD-2-Clause-Patent", "BSD-3-Clause", "BSD-3-Clause-Clear", "BSD-4-Clause",
+		"BSL-1.0", "bzip2-1.0.6", "CC-BY-3.0", "CC-BY-4.0", "CC-BY-SA-3.0",
+		"CC-BY-SA-4.0", "CC0-1.0", "CDDL-1.0", "CDDL-1.1", "CPL-1.0", "curl",
+		"ECL-2.0", "EPL-1.0", "EPL-2.0", "EUPL-1.1", "EUPL-1.2", "FTL",
+		"GFDL-1.3-only", "GFDL-1.3-or-later", "GPL-1.0-or-later", "GPL-2.0-only",
+		"GPL-2.0-or-later", "GPL-3.0-only", "GPL-3.0-or-later", "HPND", "ICU",
+		"IJG", "ImageMagick", "Info-ZIP", "IPA", "ISC", "JSON", "LGPL-2.0-only",
+		"LGPL-2.0-or-later", "LGPL-2.1-only", "LGPL-2.1-or-later", "LGPL-3.0-only",
+		"LGPL-3.0-or-later", "Libpng", "libtiff", "MirOS", "MIT", "MIT-0",
+		"MPL-1.1", "MPL-2.0", "MS-PL", "MS-RL", "NCSA", "OFL-1.1", "OpenSSL",
+		"OSL-3.0", "PHP-3.0", "PHP-3.01", "PostgreSQL", "PSF-2.0", "Python-2.0",
+		"Ruby", "Sleepycat", "TCL", "Unicode-DFS-2016", "Unlicense", "UPL-1.0",
+		"Vim", "W3C", "WTFPL", "X11", "Zlib", "ZPL-2.1",
+	} {
+		ids[strings.ToLower(id)] = id
+	}
+	return ids
+}()
+
+const spdxLicenseRefPrefix = "LicenseRef-"
+
+var (
+	spdxLicenseRefPattern = regexp.MustCompile(`^LicenseRef-[A-Za-z0-9.-]+$`)
+	spdxInvalidIDChars    = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+)
+
+// spdxLicense is the SPDX license id of license, or a LicenseRef made of it
+// if it is not on the SPDX license list, or "" if nothing is left of it
+func spdxLicense(license string) string {
+	license = strings.TrimSpace(license)
+	if id, ok := spdxLicenseIDs[strings.ToLower(license)]; ok {
+		return id
+	}
+	if spdxLicenseRefPattern.MatchString(license) {
+		return license
+	}
+	if ref := strings.Trim(spdxInvalidIDChars.ReplaceAllString(license, "-"), "-"); ref != "" {
+		return spdxLicenseRefPrefix + ref
+	}
+	return ""
+}
@@ -0,0 +1,177 @@
+package libbuildpack
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// VerifySignature checks a detached signature of file, made with the private
+// half of publicKey, a PEM encoded PKIX ("PUBLIC KEY") ECDSA, Ed25519 or RSA
+// key. ECDSA and RSA (PKCS #1 v1.5) signatures are over the sha256 of the file,
+// as produced by cosign sign-blob or openssl dgst -sha256 -sign. Ed25519
+// signatures are Ed25519ph signatures over the sha512 of the file, or plain
+// Ed25519 signatures over the file itself, which has to be read into memory
+// and so may be at most 64 MiB. The signature may be base64 encoded.
+func VerifySignature(file string, signature, publicKey []byte) error {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return fmt.Errorf("could not verify signature: no PEM encoded public key found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("could not verify signature: %v", err)
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature))); err == nil {
+		signature = decoded
+	}
+
+	var valid bool
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		digest, err := sha256File(file)
+		if err != nil {
+			return err
+		}
+		valid = ecdsa.VerifyASN1(key, digest, signature)
+	case ed25519.PublicKey:
+		if valid, err = verifyEd25519(key, file, signature); err != nil {
+			return err
+		}
+	case *rsa.PublicKey:
+		digest, err := sha256File(file)
+		if err != nil {
+			return err
+		}
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature) == nil
+	default:
+		return fmt.Errorf("could not verify signature: unsupported public key type %T", key)
+	}
+
+	if !valid {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func sha256File(file string) ([]byte, error) {
+	return hashFile(sha256.New(), file)
+}
+
+func hashFile(h hash.Hash, file string) ([]byte, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	if _, err := io.Copy(h, fh); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// maxEd25519FileSize is the largest file VerifySignature checks a plain
+// Ed25519 signature of, larger files need an Ed25519ph signature
+const maxEd25519FileSize = 64 << 20
+
+// verifyEd25519 checks an Ed25519ph signature of the sha512 of file, which it
+// streams, and then a plain Ed25519 signature of the contents of file
+func verifyEd25519(key ed25519.PublicKey, file string, signature []byte) (bool, error) {
+	digest, err := hashFile(sha512.New(), file)
+	if err != nil {
+		return false, err
+	}
+	if ed25519.VerifyWithOptions(key, digest, signature, &ed25519.Options{Hash: crypto.SHA512}) == nil {
+		return true, nil
+	}
+
+	fh, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer fh.Close()
+
+	contents, err := ioutil.ReadAll(io.LimitReader(fh, maxEd25519FileSize+1))
+	if err != nil {
+		return false, err
+	}
+	if len(contents) > maxEd25519FileSize {
+		return false, fmt.Errorf("could not verify signature: %s is larger than %d bytes, sign it with Ed25519ph instead of Ed25519", filepath.Base(file), maxEd25519FileSize)
+	}
+	return ed25519.Verify(key, contents, signature), nil
+}
+
+// verifySignature checks the signature declared by entry, if any. It fails
+// closed: a declared signature that cannot be fetched or checked is an error.
+func (i *Installer) verifySignature(entry *ManifestEntry, file string) error {
+	if entry.SignatureURI == "" && entry.SignatureFile == "" {
+		return nil
+	}
+
+	err := func() error {
+		if entry.PublicKey == "" {
+			return fmt.Errorf("no public_key given")
+		}
+		publicKey, err := ioutil.ReadFile(filepath.Join(i.manifest.manifestRootDir, entry.PublicKey))
+		if err != nil {
+			return err
+		}
+
+		signature, err := i.fetchSignature(entry, file+".sig")
+		if err != nil {
+			return err
+		}
+
+		return VerifySignature(file, signature, publicKey)
+	}()
+	if err != nil {
+		os.Remove(file)
+		return fmt.Errorf("could not verify the signature of %s %s: %v", entry.Dependency.Name, entry.Dependency.Version, err)
+	}
+
+	i.manifest.log.Debug("Verified signature of %s %s", entry.Dependency.Name, entry.Dependency.Version)
+	return nil
+}
+
+func (i *Installer) fetchSignature(entry *ManifestEntry, tmpFile string) ([]byte, error) {
+	if entry.SignatureFile != "" { // the signature is cached by the buildpack
+		return ioutil.ReadFile(filepath.Join(i.manifest.manifestRootDir, entry.SignatureFile))
+	}
+
+	uri, err := i.manifest.MirroredURI(entry.SignatureURI)
+	if err != nil {
+		return nil, err
+	}
+	client, err := i.client()
+	if err != nil {
+		return nil, err
+	}
+	if err := downloadFile(client, uri, tmpFile, i.downloadOptions, nil, nil); err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpFile)
+
+	fh, err := os.Open(tmpFile)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	return ioutil.ReadAll(io.LimitReader(fh, maxSignatureSize))
+}
+
+const maxSignatureSize = 64 << 10
@@ -0,0 +1,206 @@
+package libbuildpack_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signatures", func() {
+	const content = "exciting binary data"
+	digest := sha256.Sum256([]byte(content))
+
+	var (
+		tmpDir     string
+		file       string
+		oldCfStack string
+	)
+
+	BeforeEach(func() {
+		oldCfStack = os.Getenv("CF_STACK")
+		Expect(os.Setenv("CF_STACK", "cflinuxfs2")).To(Succeed())
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "signatures")
+		Expect(err).To(BeNil())
+		file = filepath.Join(tmpDir, "dependency.tgz")
+		Expect(ioutil.WriteFile(file, []byte(content), 0644)).To(Succeed())
+		httpmock.Reset()
+	})
+	AfterEach(func() {
+		Expect(os.Setenv("CF_STACK", oldCfStack)).To(Succeed())
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	publicKeyPEM := func(key interface{}) []byte {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		Expect(err).To(BeNil())
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+
+	Describe("VerifySignature", func() {
+		It("verifies base64 encoded ECDSA signatures of the sha256", func() {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).To(BeNil())
+			signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+			Expect(err).To(BeNil())
+
+			encoded := []byte(base64.StdEncoding.EncodeToString(signature) + "\n")
+			Expect(libbuildpack.VerifySignature(file, encoded, publicKeyPEM(&key.PublicKey))).To(Succeed())
+		})
+
+		It("verifies raw Ed25519 signatures of the contents", func() {
+			public, private, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).To(BeNil())
+			signature := ed25519.Sign(private, []byte(content))
+
+			Expect(libbuildpack.VerifySignature(file, signature, publicKeyPEM(public))).To(Succeed())
+		})
+
+		It("verifies Ed25519ph signatures of the sha512", func() {
+			public, private, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).To(BeNil())
+			digest := sha512.Sum512([]byte(content))
+			signature, err := private.Sign(nil, digest[:], &ed25519.Options{Hash: crypto.SHA512})
+			Expect(err).To(BeNil())
+
+			Expect(libbuildpack.VerifySignature(file, signature, publicKeyPEM(public))).To(Succeed())
+		})
+
+		It("does not read files over 64 MiB into memory for raw Ed25519 signatures", func() {
+			public, private, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).To(BeNil())
+			Expect(os.Truncate(file, 64<<20+1)).To(Succeed())
+			signature := ed25519.Sign(private, []byte(content))
+
+			Expect(libbuildpack.VerifySignature(file, signature, publicKeyPEM(public))).To(MatchError(ContainSubstring("sign it with Ed25519ph")))
+		})
+
+		It("verifies RSA signatures of the sha256", func() {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).To(BeNil())
+			signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+			Expect(err).To(BeNil())
+
+			Expect(libbuildpack.VerifySignature(file, signature, publicKeyPEM(&key.PublicKey))).To(Succeed())
+		})
+
+		It("rejects signatures of other contents", func() {
+			public, private, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).To(BeNil())
+			signature := ed25519.Sign(private, []byte("other data"))
+
+			Expect(libbuildpack.VerifySignature(file, signature, publicKeyPEM(public))).To(MatchError("signature mismatch"))
+		})
+
+		It("rejects keys that are not PEM encoded", func() {
+			Expect(libbuildpack.VerifySignature(file, []byte("sig"), []byte("not a key"))).To(MatchError(ContainSubstring("no PEM encoded public key found")))
+		})
+	})
+
+	Describe("Installer.FetchDependency", func() {
+		var (
+			installer *libbuildpack.Installer
+			entry     libbuildpack.ManifestEntry
+			private   ed25519.PrivateKey
+			buffer    *bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			var public ed25519.PublicKey
+			var err error
+			public, private, err = ed25519.GenerateKey(rand.Reader)
+			Expect(err).To(BeNil())
+			Expect(os.MkdirAll(filepath.Join(tmpDir, "keys"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(tmpDir, "keys", "thing.pub"), publicKeyPEM(public), 0644)).To(Succeed())
+
+			entry = libbuildpack.ManifestEntry{
+				Dependency:   libbuildpack.Dependency{Name: "thing", Version: "1"},
+				URI:          "https://example.com/dependencies/thing-1-linux-x64.tgz",
+				SHA256:       "fdf72806b9bc1a1bc78be1bfc21978d03591dea5042304211b81235dbf87bd77",
+				SignatureURI: "https://example.com/dependencies/thing-1-linux-x64.tgz.sig",
+				PublicKey:    "keys/thing.pub",
+				CFStacks:     []string{"cflinuxfs2"},
+			}
+			httpmock.RegisterResponder("GET", entry.URI, httpmock.NewStringResponder(200, content))
+		})
+
+		JustBeforeEach(func() {
+			Expect(libbuildpack.NewYAML().Write(filepath.Join(tmpDir, "manifest.yml"), libbuildpack.Manifest{
+				LanguageString:  "sample",
+				ManifestEntries: []libbuildpack.ManifestEntry{entry},
+			})).To(Succeed())
+
+			buffer = new(bytes.Buffer)
+			manifest, err := libbuildpack.NewManifest(tmpDir, libbuildpack.NewLogger(ansicleaner.New(buffer)), time.Now())
+			Expect(err).To(BeNil())
+			installer = libbuildpack.NewInstaller(manifest)
+		})
+
+		It("accepts a valid signature", func() {
+			httpmock.RegisterResponder("GET", entry.SignatureURI, httpmock.NewBytesResponder(200, ed25519.Sign(private, []byte(content))))
+
+			outputFile := filepath.Join(tmpDir, "out.tgz")
+			Expect(installer.FetchDependency(entry.Dependency, outputFile)).To(Succeed())
+			Expect(ioutil.ReadFile(outputFile)).To(Equal([]byte(content)))
+		})
+
+		It("fails closed on an invalid signature", func() {
+			httpmock.RegisterResponder("GET", entry.SignatureURI, httpmock.NewBytesResponder(200, ed25519.Sign(private, []byte("other data"))))
+
+			outputFile := filepath.Join(tmpDir, "out.tgz")
+			err := installer.FetchDependency(entry.Dependency, outputFile)
+			Expect(err).To(MatchError("could not verify the signature of thing 1: signature mismatch"))
+			Expect(outputFile).ToNot(BeAnExistingFile())
+		})
+
+		It("fails closed when the signature cannot be downloaded", func() {
+			httpmock.RegisterResponder("GET", entry.SignatureURI, httpmock.NewStringResponder(404, "not found"))
+
+			err := installer.FetchDependency(entry.Dependency, filepath.Join(tmpDir, "out.tgz"))
+			Expect(err).To(MatchError(ContainSubstring("could not verify the signature of thing 1")))
+		})
+
+		Context("the signature is cached in the buildpack", func() {
+			BeforeEach(func() {
+				entry.SignatureURI = ""
+				entry.SignatureFile = "dependencies/thing-1-linux-x64.tgz.sig"
+				Expect(os.MkdirAll(filepath.Join(tmpDir, "dependencies"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(tmpDir, entry.SignatureFile), ed25519.Sign(private, []byte(content)), 0644)).To(Succeed())
+			})
+
+			It("verifies it without downloading it", func() {
+				Expect(installer.FetchDependency(entry.Dependency, filepath.Join(tmpDir, "out.tgz"))).To(Succeed())
+			})
+		})
+
+		Context("the public key is missing", func() {
+			BeforeEach(func() { entry.PublicKey = "" })
+
+			It("fails closed", func() {
+				err := installer.FetchDependency(entry.Dependency, filepath.Join(tmpDir, "out.tgz"))
+				Expect(err).To(MatchError("could not verify the signature of thing 1: no public_key given"))
+			})
+		})
+	})
+})
@@ -150,6 +150,7 @@ func (s *Stager) CheckBuildpackValid() error {
 
 func (s *Stager) StagingComplete() {
 	s.manifest.StoreBuildpackMetadata(s.cacheDir)
+	s.log.LogStepTimings()
 }
 
 func (s *Stager) ClearCache() error {
@@ -3,21 +3,21 @@ package libbuildpack
 import (
 	"archive/tar"
 	"archive/zip"
+	"bufio"
+	"compress/bzip2"
 	"compress/gzip"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
-	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
 func init() {
@@ -76,59 +76,122 @@ func CopyDirectory(srcDir, destDir string) error {
 
 // ExtractZip extracts zipfile to destDir
 func ExtractZip(zipfile, destDir string) error {
+	return extractZip(zipfile, destDir, ExtractOptions{})
+}
+
+func extractZip(zipfile, destDir string, opts ExtractOptions) error {
 	r, err := zip.OpenReader(zipfile)
 	if err != nil {
 		return err
 	}
 	defer r.Close()
 
-	for _, f := range r.File {
-		path := filepath.Join(destDir, filepath.Clean(f.Name))
+	x, err := newArchiveExtractor(destDir, opts)
+	if err != nil {
+		return err
+	}
 
-		rc, err := f.Open()
-		if err != nil {
+	for _, f := range r.File {
+		if err := extractZipEntry(x, f); err != nil {
 			return err
 		}
+	}
 
-		if f.FileInfo().IsDir() {
-			err = os.MkdirAll(path, f.Mode())
-		} else {
-			err = writeToFile(rc, path, f.Mode())
-		}
+	return x.finish()
+}
+
+func extractZipEntry(x *archiveExtractor, f *zip.File) error {
+	mode := f.Mode()
 
-		rc.Close()
+	if mode.IsDir() {
+		return x.dir(f.Name, mode, f.Modified)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if mode&os.ModeSymlink != 0 {
+		target, err := ioutil.ReadAll(io.LimitReader(rc, maxSymlinkTargetSize))
 		if err != nil {
 			return err
 		}
+		return x.symlink(f.Name, string(target))
 	}
 
-	return nil
+	if !mode.IsRegular() {
+		x.skip(f.Name, fmt.Sprintf("unsupported file type %s", mode.Type()))
+		return nil
+	}
+
+	return x.file(f.Name, mode, f.Modified, rc)
+}
+
+// ExtractTar extracts an uncompressed tar to destDir
+func ExtractTar(tarfile, destDir string) error {
+	return extractTarFile(tarfile, destDir, ExtractOptions{})
+}
+
+func extractTarFile(tarfile, destDir string, opts ExtractOptions) error {
+	file, err := os.Open(tarfile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return extractTar(file, destDir, opts)
 }
 
+// ExtractTarXz extracts tar.xz to destDir
 func ExtractTarXz(tarfile, destDir string) error {
+	return extractTarXz(tarfile, destDir, ExtractOptions{})
+}
+
+func extractTarXz(tarfile, destDir string, opts ExtractOptions) error {
 	file, err := os.Open(tarfile)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	xz := xzReader(file)
-	defer xz.Close()
-	return extractTar(xz, destDir)
+	xzr, err := xz.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return fmt.Errorf("could not read xz stream: %v", err)
+	}
+	return extractTar(xzr, destDir, opts)
 }
 
-func xzReader(r io.Reader) io.ReadCloser {
-	rpipe, wpipe := io.Pipe()
+// ExtractTarZst extracts tar.zst to destDir
+func ExtractTarZst(tarfile, destDir string) error {
+	return extractTarZst(tarfile, destDir, ExtractOptions{})
+}
 
-	cmd := exec.Command("xz", "--decompress", "--stdout")
-	cmd.Stdin = r
-	cmd.Stdout = wpipe
+func extractTarZst(tarfile, destDir string, opts ExtractOptions) error {
+	file, err := os.Open(tarfile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	zr, err := zstd.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("could not read zstd stream: %v", err)
+	}
+	defer zr.Close()
+	return extractTar(zr, destDir, opts)
+}
 
-	go func() {
-		err := cmd.Run()
-		wpipe.CloseWithError(err)
-	}()
+// ExtractTarBz2 extracts tar.bz2 to destDir
+func ExtractTarBz2(tarfile, destDir string) error {
+	return extractTarBz2(tarfile, destDir, ExtractOptions{})
+}
 
-	return rpipe
+func extractTarBz2(tarfile, destDir string, opts ExtractOptions) error {
+	file, err := os.Open(tarfile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return extractTar(bzip2.NewReader(bufio.NewReader(file)), destDir, opts)
 }
 
 // Gets the buildpack directory
@@ -150,6 +213,10 @@ func GetBuildpackDir() (string, error) {
 
 // ExtractTarGz extracts tar.gz to destDir
 func ExtractTarGz(tarfile, destDir string) error {
+	return extractTarGz(tarfile, destDir, ExtractOptions{})
+}
+
+func extractTarGz(tarfile, destDir string, opts ExtractOptions) error {
 	file, err := os.Open(tarfile)
 	if err != nil {
 		return err
@@ -160,7 +227,7 @@ func ExtractTarGz(tarfile, destDir string) error {
 		return err
 	}
 	defer gz.Close()
-	return extractTar(gz, destDir)
+	return extractTar(gz, destDir, opts)
 }
 
 // CopyFile copies source file to destFile, creating all intermediate directories in destFile
@@ -202,55 +269,45 @@ func RandString(n int) string {
 	return string(b)
 }
 
-func extractTar(src io.Reader, destDir string) error {
+func extractTar(src io.Reader, destDir string, opts ExtractOptions) error {
 	tr := tar.NewReader(src)
 
+	x, err := newArchiveExtractor(destDir, opts)
+	if err != nil {
+		return err
+	}
+
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
 			break
 		}
-		path := filepath.Join(destDir, cleanPath(hdr.Name))
-
-		fi := hdr.FileInfo()
-		if fi.IsDir() {
-			if err := os.MkdirAll(path, hdr.FileInfo().Mode()); err != nil {
-				return err
-			}
-		} else if fi.Mode()&os.ModeSymlink != 0 {
-			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-				return err
-			}
-
-			if filepath.IsAbs(hdr.Linkname) {
-				return fmt.Errorf("cannot link to an absolute path when extracting archives")
-			}
-
-			fullLink, err := filepath.Abs(filepath.Join(filepath.Dir(path), hdr.Linkname))
-			if err != nil {
-				return err
-			}
-
-			fullDest, err := filepath.Abs(destDir)
-			if err != nil {
-				return err
-			}
-
-			// check that the relative link does not escape the destination dir
-			if !strings.HasPrefix(fullLink, fullDest) {
-				return fmt.Errorf("cannot link outside of the destination diretory when extracting archives")
-			}
+		if err != nil {
+			return err
+		}
 
-			if err = os.Symlink(hdr.Linkname, path); err != nil {
-				return err
-			}
-		} else {
-			if err := writeToFile(tr, path, hdr.FileInfo().Mode()); err != nil {
-				return err
-			}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(hdr.Name, hdr.FileInfo().Mode(), hdr.ModTime)
+		case tar.TypeReg, tar.TypeRegA:
+			err = x.file(hdr.Name, hdr.FileInfo().Mode(), hdr.ModTime, tr)
+		case tar.TypeSymlink:
+			err = x.symlink(hdr.Name, hdr.Linkname)
+		case tar.TypeLink:
+			err = x.hardlink(hdr.Name, hdr.Linkname)
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			// devices, FIFOs and other special files cannot escape destDir
+			x.skip(hdr.Name, fmt.Sprintf("unsupported tar entry type %q", hdr.Typeflag))
+			continue
+		}
+		if err != nil {
+			return err
 		}
 	}
-	return nil
+
+	return x.finish()
 }
 
 func filterURI(rawURL string) (string, error) {
@@ -275,36 +332,6 @@ func filterURI(rawURL string) (string, error) {
 	return safeURL, nil
 }
 
-func checkSha256(filePath, expectedSha256 string) error {
-	content, err := ioutil.ReadFile(filePath)
-	if err != nil {
-		return err
-	}
-
-	sum := sha256.Sum256(content)
-
-	actualSha256 := hex.EncodeToString(sum[:])
-
-	if actualSha256 != expectedSha256 {
-		return fmt.Errorf("dependency sha256 mismatch: expected sha256 %s, actual sha256 %s", expectedSha256, actualSha256)
-	}
-	return nil
-}
-
-func downloadFile(url, destFile string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return fmt.Errorf("could not download: %d", resp.StatusCode)
-	}
-
-	return writeToFile(resp.Body, destFile, 0666)
-}
-
 func writeToFile(source io.Reader, destFile string, mode os.FileMode) error {
 	err := os.MkdirAll(filepath.Dir(destFile), 0755)
 	if err != nil {
@@ -324,17 +351,3 @@ func writeToFile(source io.Reader, destFile string, mode os.FileMode) error {
 
 	return nil
 }
-
-func cleanPath(path string) string {
-	if path == "" {
-		return ""
-	}
-
-	path = filepath.Clean(path)
-	if !filepath.IsAbs(path) {
-		path = filepath.Clean(string(os.PathSeparator) + path)
-		path, _ = filepath.Rel(string(os.PathSeparator), path)
-	}
-
-	return filepath.Clean(path)
-}
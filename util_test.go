@@ -85,6 +85,13 @@ var _ = Describe("Util", func() {
 				Expect(filepath.Join(tmpdir, "passwdLink")).To(BeADirectory())
 			})
 		})
+		Context("with an entry outside of the destination", func() {
+			It("returns an error", func() {
+				err := libbuildpack.ExtractZip("fixtures/zipSlip.zip", tmpdir)
+				Expect(err).To(MatchError(ContainSubstring("outside of the destination directory")))
+				Expect(filepath.Join(filepath.Dir(tmpdir), "evil.txt")).ToNot(BeAnExistingFile())
+			})
+		})
 	})
 
 	Describe("GetBuildpackDir", func() {
@@ -214,6 +221,135 @@ var _ = Describe("Util", func() {
 				Expect(err).ToNot(BeNil())
 			})
 		})
+
+		Context("when a tar file names an entry outside of the destination", func() {
+			It("returns an error", func() {
+				err = libbuildpack.ExtractTarGz("fixtures/maliciousFileName.tgz", tmpdir)
+				Expect(err).To(MatchError(ContainSubstring("outside of the destination directory")))
+			})
+		})
+
+		Context("when a tar file links through a symlinked directory", func() {
+			It("returns an error", func() {
+				err = libbuildpack.ExtractTarGz("fixtures/maliciousSymlinkedParent.tgz", tmpdir)
+				Expect(err).To(MatchError(ContainSubstring("cannot link outside of the destination directory")))
+			})
+		})
+
+		Context("when a tar file links through a chain of symlinks", func() {
+			It("returns an error without writing or linking outside of the destination", func() {
+				destDir := filepath.Join(tmpdir, "dest")
+				err = libbuildpack.ExtractTarGz("fixtures/maliciousSymlinkChain.tgz", destDir)
+				Expect(err).To(MatchError(ContainSubstring("cannot link outside of the destination directory")))
+
+				Expect(filepath.Join(tmpdir, "escaped")).ToNot(BeADirectory())
+				Expect(filepath.Join(destDir, "l")).ToNot(BeAnExistingFile())
+			})
+		})
+
+		Context("when a tar file contains hard links", func() {
+			It("links to the file extracted earlier", func() {
+				err = libbuildpack.ExtractTarGz("fixtures/hardlink.tgz", tmpdir)
+				Expect(err).To(BeNil())
+
+				Expect(ioutil.ReadFile(filepath.Join(tmpdir, "b", "link.txt"))).To(Equal([]byte("content\n")))
+				original, err := os.Stat(filepath.Join(tmpdir, "a", "file.txt"))
+				Expect(err).To(BeNil())
+				link, err := os.Stat(filepath.Join(tmpdir, "b", "link.txt"))
+				Expect(err).To(BeNil())
+				Expect(os.SameFile(original, link)).To(BeTrue())
+			})
+
+			It("returns an error when the link points outside of the destination", func() {
+				err = libbuildpack.ExtractTarGz("fixtures/maliciousHardlink.tgz", tmpdir)
+				Expect(err).ToNot(BeNil())
+				Expect(filepath.Join(tmpdir, "passwd")).ToNot(BeAnExistingFile())
+			})
+		})
+
+		Context("when a tar file contains a device file", func() {
+			It("skips it", func() {
+				err = libbuildpack.ExtractTarGz("fixtures/device.tgz", tmpdir)
+				Expect(err).To(BeNil())
+				Expect(filepath.Join(tmpdir, "null")).ToNot(BeAnExistingFile())
+			})
+		})
+
+		It("preserves modification times", func() {
+			err = libbuildpack.ExtractTarGz("fixtures/hardlink.tgz", tmpdir)
+			Expect(err).To(BeNil())
+
+			for _, path := range []string{"a", filepath.Join("a", "file.txt")} {
+				fi, err := os.Stat(filepath.Join(tmpdir, path))
+				Expect(err).To(BeNil())
+				Expect(fi.ModTime().Unix()).To(Equal(int64(1500000000)))
+			}
+		})
+
+		Context("when the archive exceeds the extraction limits", func() {
+			var oldLimits libbuildpack.ExtractLimits
+
+			BeforeEach(func() { oldLimits = libbuildpack.DefaultExtractLimits })
+			AfterEach(func() { libbuildpack.DefaultExtractLimits = oldLimits })
+
+			It("returns an error when it expands to too many bytes", func() {
+				libbuildpack.DefaultExtractLimits = libbuildpack.ExtractLimits{MaxBytes: 10}
+				err = libbuildpack.ExtractTarGz("fixtures/thing.tgz", tmpdir)
+				Expect(err).To(MatchError(ContainSubstring("archive expands to more than 10 bytes")))
+			})
+
+			It("returns an error when it has too many entries", func() {
+				libbuildpack.DefaultExtractLimits = libbuildpack.ExtractLimits{MaxEntries: 2}
+				err = libbuildpack.ExtractTarGz("fixtures/thing.tgz", tmpdir)
+				Expect(err).To(MatchError(ContainSubstring("archive has more than 2 entries")))
+			})
+		})
+	})
+
+	Describe("ExtractTarXz, ExtractTarZst and ExtractTarBz2", func() {
+		var (
+			tmpdir string
+			err    error
+		)
+		BeforeEach(func() {
+			tmpdir, err = ioutil.TempDir("", "exploded")
+			Expect(err).To(BeNil())
+		})
+		AfterEach(func() { err = os.RemoveAll(tmpdir); Expect(err).To(BeNil()) })
+
+		extractors := map[string]func(string, string) error{
+			"xz":  libbuildpack.ExtractTarXz,
+			"zst": libbuildpack.ExtractTarZst,
+			"bz2": libbuildpack.ExtractTarBz2,
+		}
+
+		for format, extract := range extractors {
+			format, extract := format, extract
+
+			Context("with a valid tar."+format+" file", func() {
+				It("extracts all files", func() {
+					err = extract("fixtures/thing.tar."+format, tmpdir)
+					Expect(err).To(BeNil())
+
+					Expect(ioutil.ReadFile(filepath.Join(tmpdir, "root.txt"))).To(Equal([]byte("root\n")))
+					Expect(ioutil.ReadFile(filepath.Join(tmpdir, "thing", "bin", "file2.exe"))).To(Equal([]byte("progam2\n")))
+				})
+			})
+
+			Context("with an invalid tar."+format+" file", func() {
+				It("returns an error", func() {
+					err = extract("fixtures/manifest.yml", tmpdir)
+					Expect(err).ToNot(BeNil())
+				})
+			})
+		}
+
+		Context("with a truncated tar.xz file", func() {
+			It("returns an error instead of a partial extraction", func() {
+				err = libbuildpack.ExtractTarXz("fixtures/truncated.tar.xz", tmpdir)
+				Expect(err).ToNot(BeNil())
+			})
+		})
 	})
 
 	Describe("CopyFile", func() {
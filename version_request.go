@@ -0,0 +1,218 @@
+package libbuildpack
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// VersionSource is a place an app can request a version of a dependency
+// from. Version returns an empty string when the source does not request one.
+type VersionSource interface {
+	Name() string
+	Version(depName string) (string, error)
+}
+
+// VersionRequest is the version chosen for a dependency and where it was
+// requested
+type VersionRequest struct {
+	Dependency
+	Constraint string
+	Source     string
+}
+
+// DefaultVersionsSource is the name of the source used when no other source
+// requests a version
+const DefaultVersionsSource = "default_versions"
+
+type envVersionSource struct {
+	name string
+}
+
+// EnvVersionSource requests the version in the environment variable name,
+// e.g. BP_NODE_VERSION
+func EnvVersionSource(name string) VersionSource {
+	return &envVersionSource{name: name}
+}
+
+func (s *envVersionSource) Name() string { return s.name }
+
+func (s *envVersionSource) Version(string) (string, error) {
+	return strings.TrimSpace(os.Getenv(s.name)), nil
+}
+
+type versionFileSource struct {
+	file string
+}
+
+// VersionFileSource requests the version on the first line of file, like
+// .nvmrc or .ruby-version. A leading v is dropped.
+func VersionFileSource(file string) VersionSource {
+	return &versionFileSource{file: file}
+}
+
+func (s *versionFileSource) Name() string { return filepath.Base(s.file) }
+
+func (s *versionFileSource) Version(string) (string, error) {
+	data, err := ioutil.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return strings.TrimPrefix(line, "v"), nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+type toolVersionsSource struct {
+	file  string
+	tools map[string]string
+}
+
+// ToolVersionsSource requests versions in an asdf .tool-versions file. tools
+// maps dependency names to the names of the tools, when they differ, e.g.
+// node to nodejs.
+func ToolVersionsSource(file string, tools map[string]string) VersionSource {
+	return &toolVersionsSource{file: file, tools: tools}
+}
+
+func (s *toolVersionsSource) Name() string { return filepath.Base(s.file) }
+
+func (s *toolVersionsSource) Version(depName string) (string, error) {
+	data, err := ioutil.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	tool := depName
+	if name, ok := s.tools[depName]; ok {
+		tool = name
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx != -1 {
+			line = line[:idx]
+		}
+		// the first of several versions is the preferred one
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == tool {
+			return fields[1], nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+type overrideVersionSource struct {
+	depsDir  string
+	language string
+}
+
+// OverrideVersionSource requests the default versions of language set in the
+// override.yml files of depsDir, see ApplyOverride
+func OverrideVersionSource(depsDir, language string) VersionSource {
+	return &overrideVersionSource{depsDir: depsDir, language: language}
+}
+
+func (s *overrideVersionSource) Name() string { return "override.yml" }
+
+func (s *overrideVersionSource) Version(depName string) (string, error) {
+	files, err := overrideFiles(s.depsDir)
+	if err != nil {
+		return "", err
+	}
+
+	// like ApplyOverride, later files win
+	var version string
+	for _, file := range files {
+		overrideYml, err := loadOverrides(file)
+		if err != nil {
+			return "", err
+		}
+		o := overrideYml[s.language]
+		if containsString(o.Remove.DefaultVersions, depName) {
+			version = ""
+		}
+		for _, d := range append(o.DefaultVersions, o.Add.DefaultVersions...) {
+			if d.Name == depName {
+				version = d.Version
+			}
+		}
+	}
+	return version, nil
+}
+
+// StandardVersionSources are the sources of version requests, in order of
+// precedence, that buildpacks share: the BP_<NAME>_VERSION environment
+// variable, then the .tool-versions file of the app
+func StandardVersionSources(buildDir, depName string) []VersionSource {
+	env := "BP_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(depName)) + "_VERSION"
+	return []VersionSource{
+		EnvVersionSource(env),
+		ToolVersionsSource(filepath.Join(buildDir, ".tool-versions"), nil),
+	}
+}
+
+// RequestedVersion chooses the version of depName for the current stack, see
+// StackManifest.RequestedVersion
+func (m *Manifest) RequestedVersion(depName string, sources ...VersionSource) (VersionRequest, error) {
+	return m.currentStack().RequestedVersion(depName, sources...)
+}
+
+// RequestedVersion chooses the version of depName requested by the first of
+// sources that requests one, or else by default_versions, and logs where the
+// version came from. The highest version for the stack matching the request
+// is chosen.
+func (s *StackManifest) RequestedVersion(depName string, sources ...VersionSource) (VersionRequest, error) {
+	request := VersionRequest{Dependency: Dependency{Name: depName}, Source: DefaultVersionsSource}
+
+	for _, source := range sources {
+		version, err := source.Version(depName)
+		if err != nil {
+			return VersionRequest{}, fmt.Errorf("could not read the version of %s requested by %s: %v", depName, source.Name(), err)
+		}
+		if version != "" {
+			request.Constraint = version
+			request.Source = source.Name()
+			break
+		}
+	}
+
+	if request.Constraint == "" {
+		dep, err := s.DefaultVersion(depName)
+		if err != nil {
+			return VersionRequest{}, err
+		}
+		request.Constraint = dep.Version
+		request.Version = dep.Version
+		for _, d := range s.manifest.DefaultVersions {
+			if d.Name == depName {
+				request.Constraint = d.Version
+			}
+		}
+	} else {
+		resolution, err := s.Resolve(depName, request.Constraint)
+		if err != nil {
+			s.manifest.log.Error("%s", resolution.Explain())
+			return VersionRequest{}, fmt.Errorf("%s (requested by %s)", err, request.Source)
+		}
+		request.Version = resolution.Entry.Version
+	}
+
+	s.manifest.log.Info("Using %s %s, %s requested by %s", depName, request.Version, request.Constraint, request.Source)
+	return request, nil
+}
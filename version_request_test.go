@@ -0,0 +1,122 @@
+package libbuildpack_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RequestedVersion", func() {
+	var (
+		manifest   *libbuildpack.Manifest
+		buffer     *bytes.Buffer
+		buildDir   string
+		depsDir    string
+		sources    []libbuildpack.VersionSource
+		oldCfStack string
+		oldEnv     string
+	)
+
+	BeforeEach(func() {
+		oldCfStack = os.Getenv("CF_STACK")
+		Expect(os.Setenv("CF_STACK", "cflinuxfs4")).To(Succeed())
+		oldEnv = os.Getenv("BP_NODE_VERSION")
+		Expect(os.Unsetenv("BP_NODE_VERSION")).To(Succeed())
+
+		var err error
+		buffer = new(bytes.Buffer)
+		manifest, err = libbuildpack.NewManifest(filepath.Join("fixtures", "manifest", "resolve"), libbuildpack.NewLogger(buffer), time.Now())
+		Expect(err).To(BeNil())
+
+		buildDir, err = ioutil.TempDir("", "build")
+		Expect(err).To(BeNil())
+		depsDir, err = ioutil.TempDir("", "deps")
+		Expect(err).To(BeNil())
+
+		sources = append(libbuildpack.StandardVersionSources(buildDir, "node"),
+			libbuildpack.VersionFileSource(filepath.Join(buildDir, ".nvmrc")),
+			libbuildpack.OverrideVersionSource(depsDir, "nodejs"),
+		)
+	})
+	AfterEach(func() {
+		Expect(os.Setenv("CF_STACK", oldCfStack)).To(Succeed())
+		Expect(os.Setenv("BP_NODE_VERSION", oldEnv)).To(Succeed())
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+	})
+
+	It("falls back to default_versions", func() {
+		request, err := manifest.RequestedVersion("node", sources...)
+		Expect(err).To(BeNil())
+		Expect(request).To(Equal(libbuildpack.VersionRequest{
+			Dependency: libbuildpack.Dependency{Name: "node", Version: "18.17.1"},
+			Constraint: "18.x",
+			Source:     "default_versions",
+		}))
+		Expect(buffer.String()).To(ContainSubstring("Using node 18.17.1, 18.x requested by default_versions"))
+	})
+
+	It("prefers override.yml to default_versions", func() {
+		Expect(os.MkdirAll(filepath.Join(depsDir, "0"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(depsDir, "0", "override.yml"), []byte("nodejs:\n  default_versions:\n  - name: node\n    version: 16.x\n"), 0644)).To(Succeed())
+
+		request, err := manifest.RequestedVersion("node", sources...)
+		Expect(err).To(BeNil())
+		Expect(request.Version).To(Equal("16.20.0"))
+		Expect(request.Source).To(Equal("override.yml"))
+	})
+
+	It("prefers the app files to override.yml", func() {
+		Expect(os.MkdirAll(filepath.Join(depsDir, "0"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(depsDir, "0", "override.yml"), []byte("nodejs:\n  default_versions:\n  - name: node\n    version: 16.x\n"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, ".nvmrc"), []byte("v20\n"), 0644)).To(Succeed())
+
+		request, err := manifest.RequestedVersion("node", sources...)
+		Expect(err).To(BeNil())
+		Expect(request.Version).To(Equal("20.6.0"))
+		Expect(request.Constraint).To(Equal("20"))
+		Expect(request.Source).To(Equal(".nvmrc"))
+
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, ".tool-versions"), []byte("# pinned\nruby 3.2.2\nnode 18.16.0 18.17.1\n"), 0644)).To(Succeed())
+
+		request, err = manifest.RequestedVersion("node", sources...)
+		Expect(err).To(BeNil())
+		Expect(request.Version).To(Equal("18.16.0"))
+		Expect(request.Source).To(Equal(".tool-versions"))
+	})
+
+	It("prefers the environment variable to everything else", func() {
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, ".tool-versions"), []byte("node 18.16.0\n"), 0644)).To(Succeed())
+		Expect(os.Setenv("BP_NODE_VERSION", "16.x")).To(Succeed())
+
+		request, err := manifest.RequestedVersion("node", sources...)
+		Expect(err).To(BeNil())
+		Expect(request.Version).To(Equal("16.20.0"))
+		Expect(request.Source).To(Equal("BP_NODE_VERSION"))
+		Expect(buffer.String()).To(ContainSubstring("Using node 16.20.0, 16.x requested by BP_NODE_VERSION"))
+	})
+
+	It("maps dependency names to asdf tools", func() {
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, ".tool-versions"), []byte("nodejs 20.5.0\n"), 0644)).To(Succeed())
+
+		source := libbuildpack.ToolVersionsSource(filepath.Join(buildDir, ".tool-versions"), map[string]string{"node": "nodejs"})
+		request, err := manifest.RequestedVersion("node", source)
+		Expect(err).To(BeNil())
+		Expect(request.Version).To(Equal("20.5.0"))
+	})
+
+	It("names the source of a version that is not provided", func() {
+		Expect(os.Setenv("BP_NODE_VERSION", "19.x")).To(Succeed())
+
+		_, err := manifest.RequestedVersion("node", sources...)
+		Expect(err).To(MatchError("no version of node for stack cflinuxfs4 matches 19.x (requested by BP_NODE_VERSION)"))
+		Expect(buffer.String()).To(ContainSubstring("considered versions: 16.20.0, 18.16.0, 18.17.1, 20.5.0, 20.6.0"))
+	})
+})